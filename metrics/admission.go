@@ -0,0 +1,66 @@
+package metrics
+
+import "time"
+
+// defaultAdmissionWindow is the admission window of the vectors having an admission threshold but no window.
+const defaultAdmissionWindow = time.Minute
+
+// admissionCandidate is a set of label values pending admission. Only its number of accesses and the end of its
+// admission window are held, under the hash of its label values: no metric is created before the admission.
+type admissionCandidate struct {
+	// end of the admission window in unix nanoseconds
+	deadline int64
+	// number of accesses within the window
+	hits int32
+}
+
+// must be called holding shard.mutex.Lock
+//
+// onCandidateAccess counts an access to the label values of the given hash, which have no metric in the shard.
+// It returns true when the label values reached the admission threshold, and started=true when the access started a
+// new admission cycle.
+func (mv *MetricVec[M]) onCandidateAccess(shard *metricShard, hash uint64, now time.Time) (admitted, started bool) {
+	candidate, found := shard.candidates[hash]
+	if !found || now.UnixNano() > candidate.deadline {
+		candidate = admissionCandidate{deadline: now.Add(mv.opts.AdmissionWindow).UnixNano()}
+		started = true
+	}
+	candidate.hits++
+	if int(candidate.hits) >= mv.opts.AdmissionThreshold {
+		delete(shard.candidates, hash)
+		return true, started
+	}
+	shard.candidates[hash] = candidate
+	return false, started
+}
+
+// admit counts an access to label values without metric when the vector has an admission threshold.
+// It returns true when the metric of the label values must be created: they reached the admission threshold, or
+// the metric was created meanwhile by another access.
+//
+// The hashes of distinct label values may collide, in which case their accesses are counted together.
+func (mv *MetricVec[M]) admit(shard *metricShard, hash uint64, labelValues []string) bool {
+	shard.mutex.Lock()
+	if shard.tags.getElem(hash, labelValues) != nil {
+		shard.mutex.Unlock()
+		return true
+	}
+	admitted, started := mv.onCandidateAccess(shard, hash, mv.clock.Now())
+	shard.mutex.Unlock()
+	if started && !admitted {
+		// the candidate is removed by the clean-up at the end of its window
+		mv.scheduleCleanUp()
+	}
+	return admitted
+}
+
+// must be called holding shard.mutex.Lock
+//
+// expireCandidates removes the candidates of the shard whose admission window is over.
+func (s *metricShard) expireCandidates(now time.Time) {
+	for hash, candidate := range s.candidates {
+		if now.UnixNano() > candidate.deadline {
+			delete(s.candidates, hash)
+		}
+	}
+}
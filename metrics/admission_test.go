@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_AdmissionThreshold(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		Clock: clock,
+		VectorOpts: VectorOpts{
+			AdmissionThreshold: 3,
+			AdmissionWindow:    10 * time.Second,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"path"})
+	counter.WithLabelValues("/index").Add(10)
+	counter.WithLabelValues("/index").Inc()
+	counter.WithLabelValues("/scan").Inc()
+
+	// No metric has reached the admission threshold yet, their updates are counted in the overflow metric
+	assert.Equal(t, 2, counter.countPending())
+	assert.Equal(t, 1, counter.countMetrics())
+
+	// The third access admits the metric
+	counter.WithLabelValues("/index").Inc()
+	assert.Equal(t, 1, counter.countPending())
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",path="/index"} 0
+		namespace_something_count{_tag_="48ab9774",path="__overflow__"} 0
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	clock.Advance(1)
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",path="/index"} 1
+		namespace_something_count{_tag_="48ab9774",path="__overflow__"} 12
+		`
+	err = testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	// The admission window of the other label values is over, they are forgotten by the following clean-up
+	clock.Advance(21 * time.Second)
+	assert.Equal(t, 0, counter.countPending())
+	assert.Equal(t, 2, counter.countMetrics())
+
+	// A new admission cycle starts when accessed again
+	counter.WithLabelValues("/scan").Inc()
+	counter.WithLabelValues("/scan").Inc()
+	assert.Equal(t, 1, counter.countPending())
+	counter.WithLabelValues("/scan").Inc()
+	assert.Equal(t, 0, counter.countPending())
+	assert.Equal(t, 3, counter.countMetrics())
+}
+
+func TestCounterVec_AdmissionOverflowRollup(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		ExpirationDelay: 10 * time.Second,
+		RollupLabels:    prometheus.Labels{"path": "__other__"},
+		Clock:           clock,
+		VectorOpts: VectorOpts{
+			AdmissionThreshold: 2,
+			AdmissionWindow:    10 * time.Second,
+			OverflowValue:      "__pending__",
+		},
+	}
+	counter := NewCounterVec(opts, []string{"path"})
+	counter.WithLabelValues("/scan1").Add(3)
+	counter.WithLabelValues("/scan2").Add(4)
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+	testutil.CollectAndCount(counter)
+
+	// The overflow metric is a regular metric: it expires and is added to the rollup series
+	clock.Advance(11 * time.Second)
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab977f",path="__other__"} 7
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+}
+
+func TestGaugeVec_DeletePendingAdmission(t *testing.T) {
+	t.Parallel()
+
+	opts := GaugeOpts{
+		GaugeOpts: prometheus.GaugeOpts{
+			Name: "gauge",
+			Help: "Help message",
+		},
+		Clock:      metricstest.NewFakeClock(defaultTime),
+		VectorOpts: VectorOpts{AdmissionThreshold: 2},
+	}
+	gauge := NewGaugeVec(opts, []string{"path"})
+	gauge.WithLabelValues("/index").Set(1)
+	assert.Equal(t, 1, gauge.countPending())
+
+	// there is no metric to delete, but the accesses are forgotten
+	assert.False(t, gauge.DeleteLabelValues("/index"))
+	assert.Equal(t, 0, gauge.countPending())
+	gauge.WithLabelValues("/index").Set(1)
+	assert.Equal(t, 1, gauge.countPending())
+}
+
+func TestGaugeVec_DefaultAdmissionWindow(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	gauge := NewGaugeVec(GaugeOpts{
+		GaugeOpts:  prometheus.GaugeOpts{Name: "gauge", Help: "Help message"},
+		Clock:      clock,
+		VectorOpts: VectorOpts{AdmissionThreshold: 2},
+	}, []string{"path"})
+	gauge.WithLabelValues("/scan").Set(1)
+	assert.Equal(t, 1, gauge.countPending())
+
+	// the label values pending admission are forgotten by the clean-up following the end of the default window,
+	// even if not collected
+	clock.Advance(2*defaultAdmissionWindow + time.Second)
+	assert.Equal(t, 0, gauge.countPending())
+}
+
+func TestCounterVec_AdmissionWhenFull(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Clock:       clock,
+		VectorOpts:  VectorOpts{AdmissionThreshold: 2, MaxSeries: 2, LimitPolicy: LimitOverflow},
+	}
+	counter := NewCounterVec(opts, []string{"path"})
+	counter.WithLabelValues("/index").Add(2)
+	counter.WithLabelValues("/index").Add(3)
+	counter.WithLabelValues("/other").Add(4)
+
+	// the vector is full (the overflow metric is a series as well): the admitted access is redirected to the overflow metric
+	counter.WithLabelValues("/other").Add(5)
+	assert.Equal(t, 0, counter.countPending())
+	testutil.CollectAndCount(counter)
+	clock.Advance(time.Second)
+	expect := `
+		# HELP count Help message
+		# TYPE count counter
+		count{_tag_="48ab9774",path="/index"} 3
+		count{_tag_="48ab9774",path="__overflow__"} 11
+		`
+	assert.NoError(t, testutil.CollectAndCompare(counter, strings.NewReader(expect)))
+
+	// under LimitReject, the access is rejected
+	opts.LimitPolicy = LimitReject
+	counter = NewCounterVec(opts, []string{"path"})
+	counter.WithLabelValues("/index").Inc()
+	counter.WithLabelValues("/index").Inc()
+	counter.WithLabelValues("/other").Inc()
+	_, err := counter.GetMetricWithLabelValues("/other")
+	assert.ErrorIs(t, err, ErrSeriesLimitReached)
+	assert.Equal(t, 0, counter.countPending())
+}
+
+func BenchmarkCounterVec_AdmissionUniqueLabelValues(b *testing.B) {
+	counter := NewCounterVec(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Clock:       metricstest.NewFakeClock(defaultTime),
+		VectorOpts:  VectorOpts{AdmissionThreshold: 2},
+	}, []string{"path"})
+	values := make([]string, b.N)
+	for i := range values {
+		values[i] = "/scan/" + strings.Repeat("x", i%16) + string(rune('a'+i%26))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter.WithLabelValues(values[i]).Inc()
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// budgetMember is a vector of metrics drawing its series from a Budget.
+type budgetMember interface {
+	budgetPriority() int
+	// evictLeastActive evicts the least active metric of the vector.
+	evictLeastActive() bool
+}
+
+// Budget is a maximum number of series shared by several vectors of metrics, so that the total number of series
+// exported by a process is bounded whatever the number of vectors. Vectors draw series from a budget when it is
+// set in their options (see VectorOpts).
+//
+// When the budget is exhausted, the limit policy of the budget applies:
+//   - LimitReject: the vector rejects the creation of the new metric (returning ErrSeriesLimitReached)
+//   - LimitOverflow: the vector redirects the new label values to its overflow metric
+//   - LimitEvictLeastActive: the least active metric of the vector with the lowest priority is evicted, among
+//     the vectors whose priority is lower or equal to the priority of the vector creating the metric. On equal
+//     priority, the vector creating the metric is preferred.
+type Budget struct {
+	maxSeries int
+	policy    LimitPolicy
+	mutex     sync.Mutex
+	used      int
+	members   []budgetMember
+}
+
+// NewBudget creates a new Budget of maxSeries series, with the given policy applied when it is exhausted.
+func NewBudget(maxSeries int, policy LimitPolicy) *Budget {
+	return &Budget{maxSeries: maxSeries, policy: policy}
+}
+
+// MaxSeries returns the maximum number of series of the budget.
+func (b *Budget) MaxSeries() int {
+	return b.maxSeries
+}
+
+// Used returns the number of series currently exported by the vectors of the budget.
+func (b *Budget) Used() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.used
+}
+
+func (b *Budget) register(member budgetMember) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.members = append(b.members, member)
+}
+
+func (b *Budget) unregister(member budgetMember) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, m := range b.members {
+		if m == member {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// acquire takes one series from the budget for the given vector, applying the LimitEvictLeastActive policy if needed.
+func (b *Budget) acquire(requester budgetMember) bool {
+	if b.tryAcquire() {
+		return true
+	}
+	if b.policy != LimitEvictLeastActive {
+		return false
+	}
+	for _, member := range b.evictionCandidates(requester) {
+		if member.evictLeastActive() && b.tryAcquire() {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Budget) tryAcquire() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.used < b.maxSeries {
+		b.used++
+		return true
+	}
+	return false
+}
+
+// forceAcquire takes one series from the budget even if it is exhausted.
+func (b *Budget) forceAcquire() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.used++
+}
+
+func (b *Budget) release(count int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.used -= count
+}
+
+// evictionCandidates returns the vectors the requester can evict metrics from, by order of preference.
+func (b *Budget) evictionCandidates(requester budgetMember) []budgetMember {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	priority := requester.budgetPriority()
+	candidates := make([]budgetMember, 0, len(b.members))
+	for _, member := range b.members {
+		if member.budgetPriority() <= priority {
+			candidates = append(candidates, member)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := candidates[i].budgetPriority(), candidates[j].budgetPriority()
+		if pi != pj {
+			return pi < pj
+		}
+		return candidates[i] == requester && candidates[j] != requester
+	})
+	return candidates
+}
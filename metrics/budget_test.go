@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBudgetTestCounterVec(name string, budget *Budget, priority int) *MetricVec[prometheus.Counter] {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: name,
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+		VectorOpts: VectorOpts{
+			Budget:         budget,
+			BudgetPriority: priority,
+		},
+	}
+	return NewCounterVec(opts, []string{"label"})
+}
+
+func TestBudget_Reject(t *testing.T) {
+	t.Parallel()
+
+	budget := NewBudget(3, LimitReject)
+	counter1 := newBudgetTestCounterVec("count1", budget, 0)
+	counter2 := newBudgetTestCounterVec("count2", budget, 0)
+
+	counter1.WithLabelValues("toto").Inc()
+	counter1.WithLabelValues("titi").Inc()
+	counter2.WithLabelValues("toto").Inc()
+	assert.Equal(t, 3, budget.Used())
+
+	_, err := counter2.GetMetricWithLabelValues("titi")
+	assert.ErrorIs(t, err, ErrSeriesLimitReached)
+
+	counter1.DeleteLabelValues("toto")
+	assert.Equal(t, 2, budget.Used())
+	_, err = counter2.GetMetricWithLabelValues("titi")
+	assert.NoError(t, err)
+
+	counter2.Reset()
+	assert.Equal(t, 1, budget.Used())
+}
+
+func TestBudget_EvictByPriority(t *testing.T) {
+	t.Parallel()
+
+	budget := NewBudget(2, LimitEvictLeastActive)
+	low := newBudgetTestCounterVec("low", budget, 0)
+	high := newBudgetTestCounterVec("high", budget, 10)
+
+	low.WithLabelValues("toto").Inc()
+	high.WithLabelValues("toto").Inc()
+
+	// the low priority vector cannot evict metrics from the high priority one, it evicts its own metric
+	low.WithLabelValues("titi").Inc()
+	assert.Equal(t, 1, low.countMetrics())
+	assert.Equal(t, 1, high.countMetrics())
+	present := low.hasTag("titi")
+	assert.True(t, present)
+
+	// the high priority vector evicts the metric of the low priority one
+	high.WithLabelValues("titi").Inc()
+	assert.Equal(t, 0, low.countMetrics())
+	assert.Equal(t, 2, high.countMetrics())
+	assert.Equal(t, 2, budget.Used())
+
+	// the high priority vector then evicts its own metrics
+	high.WithLabelValues("tata").Inc()
+	assert.Equal(t, 2, high.countMetrics())
+	assert.Equal(t, 2, budget.Used())
+
+	// the low priority vector has no metric left to evict
+	_, err := low.GetMetricWithLabelValues("tata")
+	assert.ErrorIs(t, err, ErrSeriesLimitReached)
+}
+
+func TestCounterVec_LimitOverflow(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		Clock: clock,
+		VectorOpts: VectorOpts{
+			MaxSeries:   1,
+			LimitPolicy: LimitOverflow,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label", "other"})
+	counter.WithLabelValues("toto", "a").Add(1)
+	counter.WithLabelValues("titi", "b").Add(2)
+	counter.WithLabelValues("tata", "c").Add(3)
+
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",label="toto",other="a"} 1
+		namespace_something_count{_tag_="48ab9774",label="__overflow__",other="__overflow__"} 5
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+}
+
+// vectorRecorder is a VectorObserver recording the vectors it is notified of.
+type vectorRecorder struct {
+	vectors []Vector
+}
+
+func (r *vectorRecorder) AddVector(vector Vector) {
+	r.vectors = append(r.vectors, vector)
+}
+
+func (r *vectorRecorder) RemoveVector(vector Vector) {
+	for i, v := range r.vectors {
+		if v == vector {
+			r.vectors = append(r.vectors[:i], r.vectors[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestMetricVec_Detach(t *testing.T) {
+	t.Parallel()
+
+	budget := NewBudget(3, LimitEvictLeastActive)
+	stats := NewStatsCollector()
+	observer := &vectorRecorder{}
+	newCounterVec := func(name string) *MetricVec[prometheus.Counter] {
+		opts := CounterOpts{
+			CounterOpts: prometheus.CounterOpts{
+				Name: name,
+				Help: "Help message",
+			},
+			Clock: metricstest.NewFakeClock(defaultTime),
+			VectorOpts: VectorOpts{
+				Budget:   budget,
+				Stats:    stats,
+				Observer: observer,
+			},
+		}
+		return NewCounterVec(opts, []string{"label"})
+	}
+	counter1 := newCounterVec("count1")
+	counter2 := newCounterVec("count2")
+	counter1.WithLabelValues("toto").Inc()
+	counter1.WithLabelValues("titi").Inc()
+	counter2.WithLabelValues("toto").Inc()
+	assert.Equal(t, 3, budget.Used())
+
+	// the series of the detached vector are given back and it cannot be evicted from anymore
+	counter1.Detach()
+	assert.Equal(t, 1, budget.Used())
+	assert.Equal(t, []budgetMember{counter2}, budget.evictionCandidates(counter2))
+	assert.Equal(t, []Vector{counter2}, observer.vectors)
+	assert.Equal(t, 1, testutil.CollectAndCount(stats, "smart_vector_lifecycles_created_total"))
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import "time"
+
+// Clock provides the time to the metrics of this library.
+//
+// The default Clock is the system clock. Providing another Clock in the metrics options allows controlling the
+// time in tests, see metricstest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc waits for the duration to elapse and then calls f.
+	// It returns a function that cancels the call, and returns false if the call has already been done or canceled.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type systemClock struct{}
+
+// Now returns the current time (or the time set by SetUpNowTime).
+func (systemClock) Now() time.Time {
+	return nowFunc()
+}
+
+// AfterFunc calls f in its own goroutine after the duration has elapsed.
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+func clockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
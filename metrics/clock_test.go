@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_Clock(t *testing.T) {
+	t.Parallel()
+
+	clock1 := metricstest.NewFakeClock(defaultTime)
+	clock2 := metricstest.NewFakeClock(defaultTime.Add(time.Hour))
+
+	newCounterVec := func(clock Clock) *MetricVec[prometheus.Counter] {
+		opts := CounterOpts{
+			CounterOpts: prometheus.CounterOpts{
+				Namespace: "namespace",
+				Subsystem: "something",
+				Name:      "count",
+				Help:      "Help message",
+			},
+			WarmUpDuration: 10 * time.Second,
+			Clock:          clock,
+		}
+		return NewCounterVec(opts, []string{"label"})
+	}
+
+	// each vector follows its own timeline
+	counter1 := newCounterVec(clock1)
+	counter2 := newCounterVec(clock2)
+	counter1.WithLabelValues("toto").Add(10)
+	counter2.WithLabelValues("toto").Add(20)
+	testutil.CollectAndCount(counter1)
+	testutil.CollectAndCount(counter2)
+
+	clock1.Advance(11 * time.Second)
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",label="toto"} 10
+		`
+	err := testutil.CollectAndCompare(counter1, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48aba584",label="toto"} 0
+		`
+	err = testutil.CollectAndCompare(counter2, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_ScheduledExpiration(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		ExpirationDelay: 10 * time.Second,
+		Clock:           clock,
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+
+	// complete the warm-up
+	testutil.CollectAndCount(counter)
+	clock.Advance(time.Second)
+	testutil.CollectAndCount(counter)
+
+	clock.Advance(14 * time.Second)
+	counter.WithLabelValues("toto").Inc()
+
+	// the clean-up runs every ExpirationDelay and removes the expired metric without any collection
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, 1, counter.countMetrics())
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 0, counter.countMetrics())
+	assert.Equal(t, 0, clock.PendingCalls())
+}
@@ -15,13 +15,30 @@ type CounterOpts struct {
 	// ExpirationDelay is the maximum times a metrics keeps beeing collected when it not accessed/updated anymore.
 	// It is only applicable to vector of metrics and zero value means infinite expiration time.
 	ExpirationDelay time.Duration
+	// RollupLabels enables the rollup of the removed metrics of a vector: when a metric expires or is deleted,
+	// its final value is added to a rollup series that is never removed, so that aggregations over the vector
+	// remain monotonic. The rollup series has the label values of the removed metric, except for the labels
+	// listed here that take the given value (e.g. prometheus.Labels{"tenant": "__expired__"}).
+	// It is only applicable to vector of metrics and the given label names must be labels of the vector.
+	RollupLabels prometheus.Labels
+	// Striped enables counters spreading their increments over per-P cells, summed on collection. It avoids the
+	// contention of counters incremented from many goroutines at once, at the cost of a cache line per P and per counter.
+	// It should only be enabled for a few hot counters.
+	Striped bool
+	// Clock provides the time to the metrics (the system clock by default).
+	// It is mainly useful to control the time in tests, see metricstest.FakeClock.
+	Clock Clock
+	// VectorOpts are the options only applicable to vector of metrics.
+	VectorOpts
 }
 
 func createCounterMetricOpts(opts CounterOpts) metricOpts {
 	initialMetric := func(metric prometheus.Metric, labelValues []string) prometheus.Metric {
 		return prometheus.MustNewConstMetric(metric.Desc(), prometheus.CounterValue, 0, labelValues...)
 	}
-	return metricOpts{InitialMetric: initialMetric, WarmUpDuration: opts.WarmUpDuration, ExpirationDelay: opts.ExpirationDelay}
+	return metricOpts{FQName: prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), ConstLabels: opts.ConstLabels,
+		InitialMetric: initialMetric, WarmUpDuration: opts.WarmUpDuration, ExpirationDelay: opts.ExpirationDelay,
+		RollupLabels: opts.RollupLabels, NewRollup: newCounterRollup, Clock: opts.Clock, VectorOpts: opts.VectorOpts}
 }
 
 type counter struct {
@@ -31,7 +48,12 @@ type counter struct {
 
 // NewCounter created a new [prometheus.Counter] metric with the Warmup feature.
 func NewCounter(opts CounterOpts) prometheus.Counter {
-	promCounter := prometheus.NewCounter(opts.CounterOpts)
+	var promCounter prometheus.Counter
+	if opts.Striped {
+		promCounter = newStripedCounter(newStripedCounterDesc(opts.CounterOpts, nil))
+	} else {
+		promCounter = prometheus.NewCounter(opts.CounterOpts)
+	}
 	collector := newSingleCollector(promCounter, createCounterMetricOpts(opts))
 	return &counter{promCounter, collector}
 }
@@ -41,9 +63,29 @@ func (c *counter) Collect(ch chan<- prometheus.Metric) {
 	c.singleCollector.Collect(ch)
 }
 
+// Inc implements [prometheus.Counter], doing nothing while the counter is disabled.
+func (c *counter) Inc() {
+	if c.Enabled() {
+		c.Counter.Inc()
+	}
+}
+
+// Add implements [prometheus.Counter], doing nothing while the counter is disabled.
+func (c *counter) Add(v float64) {
+	if c.Enabled() {
+		c.Counter.Add(v)
+	}
+}
+
 // NewCounterVec created a new vector of [prometheus.Counter] metrics with the Warmup and expiration features.
 func NewCounterVec(opts CounterOpts, labelNames []string) *MetricVec[prometheus.Counter] {
 	promVecFactory := func(labelNames []string) *prometheus.MetricVec {
+		if opts.Striped {
+			desc := newStripedCounterDesc(opts.CounterOpts, labelNames)
+			return prometheus.NewMetricVec(desc, func(labelValues ...string) prometheus.Metric {
+				return newStripedCounter(desc, labelValues...)
+			})
+		}
 		counterVec := prometheus.NewCounterVec(opts.CounterOpts, labelNames)
 		return counterVec.MetricVec
 	}
@@ -242,7 +242,7 @@ func TestCounterVec_Delete(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test the internal structure and check we successfully unregistered the metrics
-	assert.Len(t, counter.metricAttrs, 1)
+	assert.Equal(t, 1, counter.countMetrics())
 }
 
 func TestCounterVec_Reset(t *testing.T) {
@@ -282,8 +282,8 @@ func TestCounterVec_Reset(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test the internal structure and check we successfully unregistered the metrics
-	assert.Len(t, counter.metricAttrs, 0)
-	assert.Len(t, counter.tags.index, 0)
+	assert.Equal(t, 0, counter.countMetrics())
+	assert.Equal(t, 0, counter.countTags())
 }
 
 func TestCounterVec_MetricsExpiration(t *testing.T) {
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryEntry is the deadline of a metric in an expiryQueue.
+type expiryEntry struct {
+	deadline int64
+	attr     *metricAttr
+}
+
+// expiryQueue is a min-heap of the deadlines of the metrics of a shard, so that finding the expired metrics
+// only costs as much as the number of metrics due.
+//
+// The deadline of an entry may be earlier than the actual deadline of its metric, since accessing a metric does not
+// update the queue: the entry is queued again with the actual deadline when it is due. A metric has at most one entry,
+// whose index is kept in the attributes of the metric so that it can be dequeued when the metric is removed.
+type expiryQueue []expiryEntry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].deadline < q[j].deadline }
+
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].attr.queueIndex = i
+	q[j].attr.queueIndex = j
+}
+
+func (q *expiryQueue) Push(x any) {
+	entry := x.(expiryEntry)
+	entry.attr.queued = true
+	entry.attr.queueIndex = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	entry.attr.queued = false
+	old[len(old)-1] = expiryEntry{}
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// due returns true when the first deadline of the queue is over.
+func (q expiryQueue) due(now time.Time) bool {
+	return len(q) > 0 && now.UnixNano() > q[0].deadline
+}
+
+// must be called holding shard.mutex.Lock
+//
+// deadline returns the time after which the metric must be removed from the vector, in unix nanoseconds:
+// the last access plus the expiration delay (of the vector or of its LabelTTL rule) for metrics that completed their
+// warm-up. It returns false when the metric cannot be removed for now.
+func (mv *MetricVec[M]) deadline(attr *metricAttr) (int64, bool) {
+	delay := mv.tunables.getExpirationDelay()
+	if attr.hasTTL {
+		delay = attr.ttl
+	}
+	if delay > 0 && attr.warmUpComplete() {
+		return attr.getLastAccess().Add(delay).UnixNano(), true
+	}
+	return 0, false
+}
+
+// must be called holding shard.mutex.Lock
+//
+// queueExpiry queues the deadline of a metric of the shard, if it has one and is not queued yet.
+func (mv *MetricVec[M]) queueExpiry(shard *metricShard, attr *metricAttr) {
+	if attr.queued {
+		return
+	}
+	if elem := shard.tags.getElem(attr.hash, attr.labelValues); elem == nil || elem.attr != attr {
+		// the metric was removed meanwhile
+		return
+	}
+	if deadline, ok := mv.deadline(attr); ok {
+		heap.Push(&shard.expiries, expiryEntry{deadline: deadline, attr: attr})
+	}
+}
+
+// must be called holding shard.mutex.Lock
+func (mv *MetricVec[M]) dequeueExpiry(shard *metricShard, attr *metricAttr) {
+	if attr.queued {
+		heap.Remove(&shard.expiries, attr.queueIndex)
+	}
+}
+
+// must be called holding shard.mutex.Lock
+//
+// expire removes the metrics of the shard whose deadline is over.
+func (mv *MetricVec[M]) expire(shard *metricShard, now time.Time) {
+	for shard.expiries.due(now) {
+		attr := heap.Pop(&shard.expiries).(expiryEntry).attr
+		elem := shard.tags.getElem(attr.hash, attr.labelValues)
+		if elem == nil || elem.attr != attr {
+			continue
+		}
+		if deadline, ok := mv.deadline(attr); ok && now.UnixNano() > deadline {
+			mv.deleteMetricByInstance(shard, elem.metric, removalExpired)
+		} else {
+			mv.queueExpiry(shard, attr)
+		}
+	}
+}
+
+// must be called holding shard.mutex.RLock or shard.mutex.Lock
+//
+// countExpired returns the number of metrics of the shard whose deadline is over, waiting for the next clean-up.
+// Only the entries of the queue that are due are visited.
+func (mv *MetricVec[M]) countExpired(shard *metricShard, now time.Time) int {
+	count := 0
+	q := shard.expiries
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(q) || now.UnixNano() <= q[i].deadline {
+			continue
+		}
+		// the entry may be earlier than the actual deadline of the metric
+		if deadline, ok := mv.deadline(q[i].attr); ok && now.UnixNano() > deadline {
+			count++
+		}
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return count
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newExpiringCounterVec(clock Clock) *MetricVec[prometheus.Counter] {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+	}
+	return NewCounterVec(opts, []string{"label"})
+}
+
+func TestCounterVec_ExpiryQueue(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := newExpiringCounterVec(clock)
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+
+	// the metrics are queued once their warm-up is complete
+	testutil.CollectAndCount(counter)
+	assert.Equal(t, 0, counter.countQueued())
+	clock.Advance(time.Second)
+	testutil.CollectAndCount(counter)
+	assert.Equal(t, 2, counter.countQueued())
+
+	// an access postpones the expiration without updating the queue
+	clock.Advance(30 * time.Second)
+	counter.WithLabelValues("toto").Inc()
+	clock.Advance(31 * time.Second)
+	assert.Equal(t, 1, testutil.CollectAndCount(counter))
+	assert.Equal(t, 1, counter.countQueued())
+	assert.True(t, counter.hasTag("toto"))
+
+	// deleting a metric removes it from the queue
+	counter.DeleteLabelValues("toto")
+	assert.Equal(t, 0, counter.countQueued())
+}
+
+func TestCounterVec_ExpiryQueueAdmission(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+		VectorOpts: VectorOpts{
+			AdmissionThreshold: 2,
+			AdmissionWindow:    10 * time.Second,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+	counter.WithLabelValues("titi").Inc()
+	// the label values pending admission are not queued, nor are the metrics before the end of their warm-up
+	assert.Equal(t, 1, counter.countPending())
+	assert.Equal(t, 0, counter.countQueued())
+
+	// the admitted metric and the overflow metric are not removed by the clean-up following the admission window
+	clock.Advance(21 * time.Second)
+	assert.Equal(t, 2, testutil.CollectAndCount(counter))
+	assert.Equal(t, 0, counter.countPending())
+	assert.Equal(t, 2, counter.countMetrics())
+}
+
+// BenchmarkMetricVec_CollectNothingExpiring measures the collection of a large vector whose metrics do not expire.
+func BenchmarkMetricVec_CollectNothingExpiring(b *testing.B) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := newExpiringCounterVec(clock)
+	for i := 0; i < 100000; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+	}
+	// complete the warm-up
+	counter.collectSnapshot()
+	clock.Advance(time.Second)
+	counter.collectSnapshot()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter.collectSnapshot()
+	}
+}
+
+// countQueued returns the number of metrics of the vector waiting for their deadline.
+func (mv *MetricVec[M]) countQueued() int {
+	count := 0
+	for i := range mv.shards {
+		mv.shards[i].mutex.RLock()
+		count += len(mv.shards[i].expiries)
+		mv.shards[i].mutex.RUnlock()
+	}
+	return count
+}
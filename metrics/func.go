@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// funcCollector is a metric whose value is provided by a function on collection, with the warm-up of the single
+// metrics. The function returns false when the value is absent: the metric keeps being collected with its last value
+// till the expiration delay has passed, and then it is not collected anymore. When the value is present again, the
+// metric starts a new warm-up.
+type funcCollector struct {
+	*singleCollector
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	function  func() (float64, bool)
+
+	mutex sync.Mutex
+	// true while the value is present or not expired yet
+	present   bool
+	lastValue float64
+	// time of the last collection with a present value
+	lastSeen time.Time
+}
+
+func newFuncCollector(desc *prometheus.Desc, valueType prometheus.ValueType, function func() (float64, bool), opts metricOpts) *funcCollector {
+	return &funcCollector{
+		singleCollector: newSingleCollector(nil, opts),
+		desc:            desc,
+		valueType:       valueType,
+		function:        function,
+	}
+}
+
+func newFuncDesc(opts prometheus.Opts) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, nil, opts.ConstLabels)
+}
+
+// value returns the current value of the metric, or false when it is absent and expired.
+func (f *funcCollector) value(now time.Time) (float64, bool) {
+	value, present := f.function()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if present {
+		if !f.present {
+			// new life cycle of the metric, restart the warm-up
+			atomic.StoreUint32(&f.attr.state, uint32(stateWarmUpPending))
+			f.present = true
+		}
+		f.lastValue = value
+		f.lastSeen = now
+		return value, true
+	}
+	if !f.present {
+		return 0, false
+	}
+	if delay := f.opts.ExpirationDelay; delay > 0 && now.Sub(f.lastSeen) >= delay {
+		f.present = false
+		return 0, false
+	}
+	return f.lastValue, true
+}
+
+// Desc implements [prometheus.Metric].
+func (f *funcCollector) Desc() *prometheus.Desc {
+	return f.desc
+}
+
+// Write implements [prometheus.Metric]. It writes the value of the metric at the last collection, without warm-up
+// (zero before the first collection). The function is not called, so that writing the metric has no side effect on
+// its life cycle.
+func (f *funcCollector) Write(out *dto.Metric) error {
+	f.mutex.Lock()
+	value := f.lastValue
+	f.mutex.Unlock()
+	return prometheus.MustNewConstMetric(f.desc, f.valueType, value).Write(out)
+}
+
+// Describe implements [prometheus.Collector].
+func (f *funcCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+// Collect implements [prometheus.Collector].
+func (f *funcCollector) Collect(ch chan<- prometheus.Metric) {
+	if !f.Enabled() {
+		return
+	}
+	now := f.clock.Now()
+	value, ok := f.value(now)
+	if !ok {
+		return
+	}
+	metric := prometheus.MustNewConstMetric(f.desc, f.valueType, value)
+	if state, _ := f.attr.onCollect(now, time.Duration(atomic.LoadInt64(&f.warmUpDuration))); state == stateWarmUpOngoing {
+		ch <- f.opts.InitialMetric(metric, nil)
+	} else {
+		ch <- metric
+	}
+}
+
+// NewCounterFunc creates a new [prometheus.CounterFunc] with the Warmup feature, whose value is provided by the given
+// function on collection. The function must be concurrency-safe and it must return a NaN value (math.NaN()) when the
+// value is absent, e.g. when the counted resource is gone: the counter is collected with its last value till the
+// ExpirationDelay has passed (forever when zero), and then it is not collected anymore. When the value is present
+// again, the counter starts a new warm-up. The options specific to vectors, RollupLabels and Striped are ignored.
+func NewCounterFunc(opts CounterOpts, function func() float64) prometheus.CounterFunc {
+	// a counter cannot be NaN, so NaN can only mean that the value is absent
+	present := func() (float64, bool) {
+		value := function()
+		return value, !math.IsNaN(value)
+	}
+	return newFuncCollector(newFuncDesc(prometheus.Opts(opts.CounterOpts)), prometheus.CounterValue, present, createCounterMetricOpts(opts))
+}
+
+// NewGaugeFunc creates a new [prometheus.GaugeFunc] whose value is provided by the given function on collection.
+// Unlike for NewCounterFunc, a NaN value is a legitimate value of the gauge and it is collected as is: the value is
+// always present. The ExpirationDelay and the options specific to vectors are ignored.
+func NewGaugeFunc(opts GaugeOpts, function func() float64) prometheus.GaugeFunc {
+	return newFuncCollector(newFuncDesc(prometheus.Opts(opts.GaugeOpts)), prometheus.GaugeValue, alwaysPresent(function), createGaugeMetricOpts(opts))
+}
+
+// NewUntypedFunc creates a new [prometheus.UntypedFunc] whose value is provided by the given function on collection.
+// Like for NewGaugeFunc, a NaN value is collected as is. The ExpirationDelay and the options specific to vectors are
+// ignored.
+func NewUntypedFunc(opts UntypedOpts, function func() float64) prometheus.UntypedFunc {
+	return newFuncCollector(newFuncDesc(prometheus.Opts(opts.UntypedOpts)), prometheus.UntypedValue, alwaysPresent(function), createUntypedMetricOpts(opts))
+}
+
+// alwaysPresent returns a function whose values are always present, NaN included.
+func alwaysPresent(function func() float64) func() (float64, bool) {
+	return func() (float64, bool) {
+		return function(), true
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterFunc_WarmUpAndExpiration(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	var value uint64 = math.Float64bits(10)
+	counter := NewCounterFunc(CounterOpts{
+		CounterOpts:     prometheus.CounterOpts{Name: "connections_total", Help: "Help message"},
+		WarmUpDuration:  10 * time.Second,
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+	}, func() float64 { return math.Float64frombits(atomic.LoadUint64(&value)) })
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(counter))
+	clock.Advance(11 * time.Second)
+	assert.Equal(t, float64(10), testutil.ToFloat64(counter))
+
+	// the value is absent: the last value is collected till the expiration
+	atomic.StoreUint64(&value, math.Float64bits(math.NaN()))
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, float64(10), testutil.ToFloat64(counter))
+	clock.Advance(time.Minute)
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+
+	// the value is present again: new warm-up
+	atomic.StoreUint64(&value, math.Float64bits(3))
+	assert.Equal(t, float64(0), testutil.ToFloat64(counter))
+	clock.Advance(11 * time.Second)
+	assert.Equal(t, float64(3), testutil.ToFloat64(counter))
+}
+
+func TestCounterFunc_WriteHasNoSideEffect(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	calls := 0
+	counter := NewCounterFunc(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "connections_total", Help: "Help message"},
+		Clock:       clock,
+	}, func() float64 {
+		calls++
+		return float64(calls)
+	})
+
+	// Write reads the value of the last collection without calling the function
+	metric := &dto.Metric{}
+	assert.NoError(t, counter.Write(metric))
+	assert.Equal(t, 0.0, metric.GetCounter().GetValue())
+	testutil.CollectAndCount(counter)
+	assert.NoError(t, counter.Write(metric))
+	assert.Equal(t, 1.0, metric.GetCounter().GetValue())
+	assert.Equal(t, 1, calls)
+}
+
+func TestGaugeFunc_NaN(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	value := 5.0
+	gauge := NewGaugeFunc(GaugeOpts{
+		GaugeOpts:       prometheus.GaugeOpts{Name: "ratio", Help: "Help message"},
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+	}, func() float64 { return value })
+	assert.Equal(t, 5.0, testutil.ToFloat64(gauge))
+
+	// NaN is a legitimate value of a gauge, it is collected and the gauge never expires
+	value = math.NaN()
+	clock.Advance(time.Hour)
+	assert.True(t, math.IsNaN(testutil.ToFloat64(gauge)))
+}
+
+func TestUntypedFunc_NaN(t *testing.T) {
+	untyped := NewUntypedFunc(UntypedOpts{
+		UntypedOpts: prometheus.UntypedOpts{Name: "external", Help: "Help message"},
+	}, math.NaN)
+	assert.Equal(t, 1, testutil.CollectAndCount(untyped))
+	assert.True(t, math.IsNaN(testutil.ToFloat64(untyped)))
+}
+
+func TestCounterFunc_SetEnabled(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := NewCounterFunc(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "connections_total", Help: "Help message"},
+		Clock:       clock,
+	}, func() float64 { return 1 })
+	switchable := counter.(Switchable)
+	switchable.SetEnabled(false)
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+	switchable.SetEnabled(true)
+	assert.Equal(t, float64(0), testutil.ToFloat64(counter))
+	clock.Advance(time.Second)
+	assert.Equal(t, float64(1), testutil.ToFloat64(counter))
+}
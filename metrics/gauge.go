@@ -11,6 +11,11 @@ type GaugeOpts struct {
 	// ExpirationDelay is the maximum times a metrics keeps beeing collected when it not accessed/updated anymore.
 	// It is only applicable to vector of metrics and zero value means infinite expiration time.
 	ExpirationDelay time.Duration
+	// Clock provides the time to the metrics (the system clock by default).
+	// It is mainly useful to control the time in tests, see metricstest.FakeClock.
+	Clock Clock
+	// VectorOpts are the options only applicable to vector of metrics.
+	VectorOpts
 }
 
 func createGaugeMetricOpts(opts GaugeOpts) metricOpts {
@@ -19,11 +24,69 @@ func createGaugeMetricOpts(opts GaugeOpts) metricOpts {
 		// for Gauge we disable it returning the metric itself as initial value
 		return metric
 	}
-	return metricOpts{InitialMetric: initialMetric, ExpirationDelay: opts.ExpirationDelay}
+	return metricOpts{FQName: prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), ConstLabels: opts.ConstLabels,
+		InitialMetric: initialMetric, ExpirationDelay: opts.ExpirationDelay, Clock: opts.Clock, VectorOpts: opts.VectorOpts}
 }
 
-// Note: for Gauge we don't need WarmUp so we do not provide constructor for single Metric
-// (since it would not add any value to the existing prometheus.NewGauge(..))
+type gauge struct {
+	prometheus.Gauge
+	*singleCollector
+}
+
+// NewGauge created a new [prometheus.Gauge] metric. Gauges have no warm-up, unlike prometheus.NewGauge the created
+// gauge can be disabled at runtime (see Switchable).
+func NewGauge(opts GaugeOpts) prometheus.Gauge {
+	promGauge := prometheus.NewGauge(opts.GaugeOpts)
+	collector := newSingleCollector(promGauge, createGaugeMetricOpts(opts))
+	return &gauge{promGauge, collector}
+}
+
+// Collect implements [prometheus.Collector].
+func (g *gauge) Collect(ch chan<- prometheus.Metric) {
+	g.singleCollector.Collect(ch)
+}
+
+// Set implements [prometheus.Gauge], doing nothing while the gauge is disabled.
+func (g *gauge) Set(v float64) {
+	if g.Enabled() {
+		g.Gauge.Set(v)
+	}
+}
+
+// Inc implements [prometheus.Gauge], doing nothing while the gauge is disabled.
+func (g *gauge) Inc() {
+	if g.Enabled() {
+		g.Gauge.Inc()
+	}
+}
+
+// Dec implements [prometheus.Gauge], doing nothing while the gauge is disabled.
+func (g *gauge) Dec() {
+	if g.Enabled() {
+		g.Gauge.Dec()
+	}
+}
+
+// Add implements [prometheus.Gauge], doing nothing while the gauge is disabled.
+func (g *gauge) Add(v float64) {
+	if g.Enabled() {
+		g.Gauge.Add(v)
+	}
+}
+
+// Sub implements [prometheus.Gauge], doing nothing while the gauge is disabled.
+func (g *gauge) Sub(v float64) {
+	if g.Enabled() {
+		g.Gauge.Sub(v)
+	}
+}
+
+// SetToCurrentTime implements [prometheus.Gauge], doing nothing while the gauge is disabled.
+func (g *gauge) SetToCurrentTime() {
+	if g.Enabled() {
+		g.Gauge.SetToCurrentTime()
+	}
+}
 
 // NewGaugeVec created a new vector of [prometheus.Gauge] metrics with expiration features.
 func NewGaugeVec(opts GaugeOpts, labelNames []string) *MetricVec[prometheus.Gauge] {
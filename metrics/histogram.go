@@ -15,6 +15,17 @@ type HistogramOpts struct {
 	// ExpirationDelay is the maximum times a metrics keeps beeing collected when it not accessed/updated anymore.
 	// It is only applicable to vector of metrics and zero value means infinite expiration time.
 	ExpirationDelay time.Duration
+	// RollupLabels enables the rollup of the removed metrics of a vector: when a metric expires or is deleted,
+	// its final value is added to a rollup series that is never removed, so that aggregations over the vector
+	// remain monotonic. The rollup series has the label values of the removed metric, except for the labels
+	// listed here that take the given value (e.g. prometheus.Labels{"tenant": "__expired__"}).
+	// It is only applicable to vector of metrics and the given label names must be labels of the vector.
+	RollupLabels prometheus.Labels
+	// Clock provides the time to the metrics (the system clock by default).
+	// It is mainly useful to control the time in tests, see metricstest.FakeClock.
+	Clock Clock
+	// VectorOpts are the options only applicable to vector of metrics.
+	VectorOpts
 }
 
 func createHistogramMetricOpts(opts HistogramOpts) metricOpts {
@@ -25,7 +36,9 @@ func createHistogramMetricOpts(opts HistogramOpts) metricOpts {
 	initialMetric := func(metric prometheus.Metric, labelValues []string) prometheus.Metric {
 		return prometheus.MustNewConstHistogram(metric.Desc(), 0, 0, initialBuckets, labelValues...)
 	}
-	return metricOpts{InitialMetric: initialMetric, WarmUpDuration: opts.WarmUpDuration, ExpirationDelay: opts.ExpirationDelay}
+	return metricOpts{FQName: prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), ConstLabels: opts.ConstLabels,
+		InitialMetric: initialMetric, WarmUpDuration: opts.WarmUpDuration, ExpirationDelay: opts.ExpirationDelay,
+		RollupLabels: opts.RollupLabels, NewRollup: newHistogramRollup, Clock: opts.Clock, VectorOpts: opts.VectorOpts}
 }
 
 type histogram struct {
@@ -45,6 +58,13 @@ func (h *histogram) Collect(ch chan<- prometheus.Metric) {
 	h.singleCollector.Collect(ch)
 }
 
+// Observe implements [prometheus.Histogram], doing nothing while the histogram is disabled.
+func (h *histogram) Observe(value float64) {
+	if h.Enabled() {
+		h.Histogram.Observe(value)
+	}
+}
+
 // NewHistogramVec created a new vector of [prometheus.Histogram] metrics with the Warmup and expiration features.
 func NewHistogramVec(opts HistogramOpts, labelNames []string) *MetricVec[prometheus.Histogram] {
 	promVecFactory := func(labelNames []string) *prometheus.MetricVec {
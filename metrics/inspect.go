@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Vector is the interface of the vectors of metrics whatever the type of their metrics (see MetricVec),
+// allowing to inspect and manage vectors of different types together.
+type Vector interface {
+	prometheus.Collector
+	// Name returns the fully-qualified name of the metrics of the vector.
+	Name() string
+	// ID returns the name of the vector followed by its constant labels, identifying it among the vectors of the same name.
+	ID() string
+	// LabelNames returns the names of the variable labels of the vector, without the internal LabelLifeCycleTag.
+	LabelNames() []string
+	// Inspect returns the state of the metrics of the vector.
+	Inspect() []SeriesInfo
+	// DeleteLabelValues removes the metric of the given label values.
+	DeleteLabelValues(labelValues ...string) bool
+	// DeletePartialMatchLabelValues removes the metrics matching the given labels and returns their label values.
+	DeletePartialMatchLabelValues(labels prometheus.Labels) [][]string
+	// Quarantine prevents the creation of the metrics matching the given labels for the given duration.
+	Quarantine(labels prometheus.Labels, d time.Duration) bool
+	// Reset removes all the metrics of the vector.
+	Reset()
+	// SetWarmUpDuration changes the warm-up duration of the metrics of the vector.
+	WarmUpSetter
+	// SetExpirationDelay changes the expiration delay of the metrics of the vector.
+	SetExpirationDelay(d time.Duration)
+	// SetMaxSeries changes the maximum number of metrics exported by the vector.
+	SetMaxSeries(maxSeries int)
+	// SetLimitPolicy changes the policy applied when the vector is full.
+	SetLimitPolicy(policy LimitPolicy)
+	// SetEnabled disables or re-enables the vector.
+	Switchable
+	// Detach removes the vector from its Budget, StatsCollector and Observer.
+	Detach()
+}
+
+// VectorObserver is notified of the creation of the vectors having it in their options (see VectorOpts),
+// and of their removal (see MetricVec.Detach).
+type VectorObserver interface {
+	AddVector(vector Vector)
+	RemoveVector(vector Vector)
+}
+
+// Values of SeriesInfo.State.
+const (
+	SeriesWarmUpPending    = "warm_up_pending"
+	SeriesWarmUpOngoing    = "warm_up_ongoing"
+	SeriesWarmUpComplete   = "warm_up_complete"
+	SeriesPendingAdmission = "pending_admission"
+)
+
+// SeriesInfo is the state of a metric of a vector, see MetricVec.Inspect.
+type SeriesInfo struct {
+	// LabelValues are the values of the variable labels of the metric, in the order of Vector.LabelNames.
+	LabelValues []string
+	// Tag is the value of the LabelLifeCycleTag label of the metric.
+	Tag string
+	// State is the state of the metric: SeriesWarmUpPending, SeriesWarmUpOngoing, SeriesWarmUpComplete
+	// or SeriesPendingAdmission.
+	State string
+	// LastAccess is the time of the last access to the metric.
+	LastAccess time.Time
+	// ExpiresAt is the time after which the metric is removed from the vector if not accessed anymore
+	// (or not admitted for a metric pending admission). Zero value means the metric cannot expire for now.
+	ExpiresAt time.Time
+}
+
+// Name returns the fully-qualified name of the metrics of the vector.
+func (mv *MetricVec[M]) Name() string {
+	return mv.opts.FQName
+}
+
+// ID returns the fully-qualified name of the metrics of the vector followed by their constant labels, if any
+// (e.g. requests_total{component="api"}). Unlike the name, it identifies the vector among the vectors of a registry.
+func (mv *MetricVec[M]) ID() string {
+	return mv.id
+}
+
+// ID returns the identity of the metrics of the given fully-qualified name and constant labels: the name followed by
+// the constant labels sorted by name, if any (e.g. requests_total{component="api"}). Like in a registry, the metrics
+// of the same name are told apart by their constant labels.
+func ID(fqName string, constLabels prometheus.Labels) string {
+	if len(constLabels) == 0 {
+		return fqName
+	}
+	names := make([]string, 0, len(constLabels))
+	for name := range constLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(fqName)
+	for i, name := range names {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(constLabels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// LabelNames returns the names of the variable labels of the vector, without the internal LabelLifeCycleTag.
+func (mv *MetricVec[M]) LabelNames() []string {
+	return append([]string(nil), mv.labelNames...)
+}
+
+// Inspect returns the state of the metrics of the vector sorted by label values. The label values pending admission
+// are not included, since only a hash of them is kept (see AdmissionThreshold). It is meant for debugging and costs as much as a collection of the vector.
+func (mv *MetricVec[M]) Inspect() []SeriesInfo {
+	var series []SeriesInfo
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.RLock()
+		for _, attr := range shard.metricAttrs {
+			info := SeriesInfo{
+				LabelValues: append([]string(nil), attr.labelValues...),
+				Tag:         attr.tag,
+				State:       stateNames[atomic.LoadUint32(&attr.state)],
+				LastAccess:  attr.getLastAccess(),
+			}
+			if deadline, ok := mv.deadline(attr); ok {
+				info.ExpiresAt = time.Unix(0, deadline)
+			}
+			series = append(series, info)
+		}
+		shard.mutex.RUnlock()
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return lessStringSlice(series[i].LabelValues, series[j].LabelValues)
+	})
+	return series
+}
+
+func lessStringSlice(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricVec_Inspect(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		Clock: clock,
+		VectorOpts: VectorOpts{
+			AdmissionThreshold: 2,
+			AdmissionWindow:    10 * time.Second,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("toto").Inc()
+	clock.Advance(time.Second)
+	counter.WithLabelValues("titi").Inc()
+
+	var vector Vector = counter
+	assert.Equal(t, "namespace_count", vector.Name())
+	assert.Equal(t, []string{"label"}, vector.LabelNames())
+	// the label values pending admission are not listed, their updates are counted in the overflow metric
+	series := vector.Inspect()
+	assert.Len(t, series, 2)
+	assert.Equal(t, []string{"__overflow__"}, series[0].LabelValues)
+	assert.Equal(t, "48ab9774", series[0].Tag)
+	assert.Equal(t, SeriesWarmUpPending, series[0].State)
+	assert.True(t, defaultTime.Add(time.Second).Equal(series[0].LastAccess))
+	assert.True(t, series[0].ExpiresAt.IsZero())
+	assert.Equal(t, []string{"toto"}, series[1].LabelValues)
+	assert.Equal(t, "48ab9774", series[1].Tag)
+	assert.Equal(t, SeriesWarmUpPending, series[1].State)
+	assert.True(t, defaultTime.Equal(series[1].LastAccess))
+	assert.True(t, series[1].ExpiresAt.IsZero())
+}
+
+func TestID(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "namespace_count", ID("namespace_count", nil))
+	assert.Equal(t, `namespace_count{app="test",component="a \"b\""}`,
+		ID("namespace_count", prometheus.Labels{"component": `a "b"`, "app": "test"}))
+
+	counter := NewCounterVec(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message", ConstLabels: prometheus.Labels{"app": "test"}},
+	}, []string{"label"})
+	assert.Equal(t, `count{app="test"}`, counter.ID())
+}
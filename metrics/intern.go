@@ -0,0 +1,73 @@
+package metrics
+
+import "sync"
+
+// Interner stores each distinct label value once, so that the metrics of the vectors sharing it
+// (see VectorOpts.Interner) refer to the same copy of their label values, whatever the vector.
+// This saves memory when the same label values (e.g. tenant IDs) are used by many metrics.
+//
+// The label values are reference counted: a value is dropped from the Interner with the last metric using it.
+type Interner struct {
+	mutex  sync.Mutex
+	values map[string]*internedValue
+	bytes  int64
+}
+
+type internedValue struct {
+	value string
+	refs  int
+}
+
+// NewInterner creates a new Interner.
+func NewInterner() *Interner {
+	return &Interner{values: make(map[string]*internedValue)}
+}
+
+// Len returns the number of distinct label values stored by the Interner.
+func (i *Interner) Len() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return len(i.values)
+}
+
+// MemoryBytes returns the number of bytes of the label values stored by the Interner.
+func (i *Interner) MemoryBytes() int64 {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.bytes
+}
+
+// intern replaces the given values by their interned copy, taking a reference on each of them.
+func (i *Interner) intern(values []string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for j, value := range values {
+		interned := i.values[value]
+		if interned == nil {
+			// the value is copied so that it never retains a larger string it would be a part of
+			value = string([]byte(value))
+			interned = &internedValue{value: value}
+			i.values[value] = interned
+			i.bytes += int64(len(value))
+		}
+		interned.refs++
+		values[j] = interned.value
+	}
+}
+
+// release releases a reference on each of the given interned values.
+func (i *Interner) release(values []string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, value := range values {
+		interned := i.values[value]
+		if interned == nil {
+			continue
+		}
+		interned.refs--
+		if interned.refs <= 0 {
+			delete(i.values, value)
+			i.bytes -= int64(len(value))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInterner_InternRelease(t *testing.T) {
+	interner := NewInterner()
+
+	values1 := []string{string([]byte("tenant")), "toto"}
+	values2 := []string{string([]byte("tenant")), "titi"}
+	assert.NotEqual(t, stringData(values1[0]), stringData(values2[0]))
+
+	interner.intern(values1)
+	interner.intern(values2)
+	assert.Equal(t, stringData(values1[0]), stringData(values2[0]))
+	assert.Equal(t, 3, interner.Len())
+	assert.Equal(t, int64(14), interner.MemoryBytes())
+
+	interner.release(values1)
+	assert.Equal(t, 2, interner.Len())
+	assert.Equal(t, int64(10), interner.MemoryBytes())
+	interner.release(values2)
+	assert.Equal(t, 0, interner.Len())
+	assert.Equal(t, int64(0), interner.MemoryBytes())
+}
+
+func TestCounterVec_Interner(t *testing.T) {
+	t.Parallel()
+
+	interner := NewInterner()
+	newCounterVec := func(name string) *MetricVec[prometheus.Counter] {
+		opts := CounterOpts{
+			CounterOpts: prometheus.CounterOpts{
+				Name: name,
+				Help: "Help message",
+			},
+			Clock:      metricstest.NewFakeClock(defaultTime),
+			VectorOpts: VectorOpts{Interner: interner},
+		}
+		return NewCounterVec(opts, []string{"tenant"})
+	}
+	counter1 := newCounterVec("count1")
+	counter2 := newCounterVec("count2")
+
+	counter1.WithLabelValues(string([]byte("toto"))).Inc()
+	counter2.WithLabelValues(string([]byte("toto"))).Inc()
+	counter2.WithLabelValues("titi").Inc()
+	// "toto", "titi" and the tag
+	assert.Equal(t, 3, interner.Len())
+	assert.Equal(t, stringData(counter1.attrOf("toto").labelValues[0]), stringData(counter2.attrOf("toto").labelValues[0]))
+
+	counter2.DeleteLabelValues("toto")
+	assert.Equal(t, 3, interner.Len())
+	counter2.Reset()
+	assert.Equal(t, 2, interner.Len())
+	counter1.DeleteLabelValues("toto")
+	assert.Equal(t, 0, interner.Len())
+}
+
+func TestCounterVec_MemoryBytes(t *testing.T) {
+	t.Parallel()
+
+	newCounterVec := func(interner *Interner) *MetricVec[prometheus.Counter] {
+		opts := CounterOpts{
+			CounterOpts: prometheus.CounterOpts{
+				Name: "count",
+				Help: "Help message",
+			},
+			Clock:      metricstest.NewFakeClock(defaultTime),
+			VectorOpts: VectorOpts{Interner: interner},
+		}
+		return NewCounterVec(opts, []string{"tenant"})
+	}
+	counter := newCounterVec(nil)
+	assert.Equal(t, int64(0), counter.MemoryBytes())
+	counter.WithLabelValues("toto").Inc()
+	one := counter.MemoryBytes()
+	assert.Greater(t, one, int64(0))
+	counter.WithLabelValues("titi").Inc()
+	assert.Equal(t, 2*one, counter.MemoryBytes())
+
+	// the label values are accounted by the interner
+	interner := NewInterner()
+	internedCounter := newCounterVec(interner)
+	internedCounter.WithLabelValues("toto").Inc()
+	assert.Equal(t, one, internedCounter.MemoryBytes()+interner.MemoryBytes())
+
+	counter.Reset()
+	assert.Equal(t, int64(0), counter.MemoryBytes())
+}
+
+// attrOf returns the attributes of the metric of the given label values, nil if there is none.
+func (mv *MetricVec[M]) attrOf(labelValues ...string) *metricAttr {
+	shard := mv.shard(hashStringSlice(labelValues))
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	if elem := shard.tags.getElem(hashStringSlice(labelValues), labelValues); elem != nil {
+		return elem.attr
+	}
+	return nil
+}
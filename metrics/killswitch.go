@@ -0,0 +1,61 @@
+package metrics
+
+import "sync/atomic"
+
+// Switchable is implemented by the metrics that can be disabled at runtime, e.g. when a vector explodes in
+// cardinality: the single metrics created by this package, and all the vectors of metrics.
+type Switchable interface {
+	// SetEnabled disables or re-enables the metric.
+	SetEnabled(enabled bool)
+	// Enabled returns false while the metric is disabled.
+	Enabled() bool
+}
+
+// SetEnabled disables or re-enables the metric. A disabled metric is not collected and its updates are discarded,
+// so that it resumes from its value at the time it was disabled. When re-enabled, the metric starts a new warm-up.
+func (c *singleCollector) SetEnabled(enabled bool) {
+	if enabled {
+		// restart the warm-up before collecting the metric again
+		atomic.StoreUint32(&c.attr.state, uint32(stateWarmUpPending))
+		atomic.StoreInt32(&c.disabled, 0)
+	} else {
+		atomic.StoreInt32(&c.disabled, 1)
+	}
+}
+
+// Enabled returns false while the metric is disabled, see SetEnabled.
+func (c *singleCollector) Enabled() bool {
+	return atomic.LoadInt32(&c.disabled) == 0
+}
+
+// SetEnabled disables or re-enables the vector.
+//
+// Disabling the vector removes all its metrics (like Reset). While disabled, nothing is collected and the accesses
+// to the metrics of the vector are cheap: they all return the same detached metric, whose updates are discarded.
+// When re-enabled, the metrics start new life cycles, with a new tag and warm-up.
+func (mv *MetricVec[M]) SetEnabled(enabled bool) {
+	if !enabled {
+		if atomic.LoadInt32(&mv.disabled) != 0 {
+			return
+		}
+		mv.cleanUpMutex.Lock()
+		if mv.discard == nil {
+			mv.discard, _ = mv.detachedMetric(make([]string, len(mv.labelNames)))
+		}
+		mv.cleanUpMutex.Unlock()
+		atomic.StoreInt32(&mv.disabled, 1)
+		mv.Reset()
+		return
+	}
+	if atomic.LoadInt32(&mv.disabled) == 0 {
+		return
+	}
+	// remove the metrics created by the accesses concurrent with the disabling
+	mv.Reset()
+	atomic.StoreInt32(&mv.disabled, 0)
+}
+
+// Enabled returns false while the vector is disabled, see SetEnabled.
+func (mv *MetricVec[M]) Enabled() bool {
+	return atomic.LoadInt32(&mv.disabled) == 0
+}
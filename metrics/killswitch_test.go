@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricVec_SetEnabled(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := newExpiringCounterVec(clock)
+	counter.WithLabelValues("toto").Inc()
+	assert.Equal(t, 1, testutil.CollectAndCount(counter))
+
+	counter.SetEnabled(false)
+	assert.False(t, counter.Enabled())
+	assert.Equal(t, 0, counter.countMetrics())
+	assert.Equal(t, int64(0), counter.seriesCount)
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Add(2)
+	assert.Same(t, counter.WithLabelValues("toto"), counter.WithLabelValues("tata"))
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+	allocs := testing.AllocsPerRun(100, func() {
+		counter.WithLabelValues("toto").Inc()
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	// the metrics start new life cycles within the same second
+	counter.SetEnabled(true)
+	assert.True(t, counter.Enabled())
+	counter.WithLabelValues("toto").Inc()
+	assert.Equal(t, 1, counter.countMetrics())
+	assert.Equal(t, "48ab9775", counter.Inspect()[0].Tag)
+	assert.Equal(t, 0.0, testutil.ToFloat64(counter), "the metric warms up")
+}
+
+func TestCounter_SetEnabled(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := NewCounter(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		WarmUpDuration: time.Minute,
+		Clock:          clock,
+	})
+	counter.Inc()
+	testutil.CollectAndCount(counter)
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter))
+
+	switchable := counter.(Switchable)
+	switchable.SetEnabled(false)
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+	// the updates are discarded while disabled
+	counter.Add(5)
+
+	// the counter warms up again from its value when disabled
+	switchable.SetEnabled(true)
+	assert.Equal(t, 0.0, testutil.ToFloat64(counter))
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter))
+	counter.Inc()
+	assert.Equal(t, 2.0, testutil.ToFloat64(counter))
+}
+
+func TestHistogram_SetEnabled(t *testing.T) {
+	t.Parallel()
+
+	histogram := NewHistogram(HistogramOpts{
+		HistogramOpts: prometheus.HistogramOpts{
+			Name: "latency",
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+	})
+	histogram.Observe(1)
+	switchable := histogram.(Switchable)
+	switchable.SetEnabled(false)
+	histogram.Observe(2)
+	switchable.SetEnabled(true)
+
+	metric := &dto.Metric{}
+	assert.NoError(t, histogram.(prometheus.Metric).Write(metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+}
+
+func TestGauge_SetEnabled(t *testing.T) {
+	t.Parallel()
+
+	gauge := NewGauge(GaugeOpts{
+		GaugeOpts: prometheus.GaugeOpts{
+			Name: "sessions",
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+	})
+	gauge.Set(3)
+	assert.Equal(t, 3.0, testutil.ToFloat64(gauge))
+
+	switchable := gauge.(Switchable)
+	switchable.SetEnabled(false)
+	assert.Equal(t, 0, testutil.CollectAndCount(gauge))
+	gauge.Inc()
+	gauge.Sub(2)
+
+	// the gauge has no warm-up, it is collected again with its value when disabled
+	switchable.SetEnabled(true)
+	assert.Equal(t, 3.0, testutil.ToFloat64(gauge))
+}
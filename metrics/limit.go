@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"container/heap"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrSeriesLimitReached is returned when a new metric cannot be added to a vector because it is full.
+var ErrSeriesLimitReached = errors.New("series limit reached")
+
+// LimitPolicy defines how a vector of metrics behaves when it is full.
+type LimitPolicy int
+
+const (
+	// LimitReject rejects the creation of new metrics: GetMetricWithLabelValues returns ErrSeriesLimitReached
+	// (and WithLabelValues panics).
+	LimitReject LimitPolicy = iota
+	// LimitEvictLeastActive removes the least recently accessed metric of the vector to make room for the new one.
+	// The evicted metric is handled exactly like an expired one: it is added to the rollup series when configured,
+	// and its label values start a new life cycle (with a new tag and warm-up) when accessed again.
+	LimitEvictLeastActive
+	// LimitOverflow redirects the new label values to an overflow metric whose label values are all set to
+	// OverflowValue. The overflow metric is created even if the vector is full.
+	LimitOverflow
+)
+
+const defaultOverflowValue = "__overflow__"
+
+// reserve reserves one more exported series for the vector (and from its budget), applying the limit policies if needed.
+// When the vector is full, it returns false and the limit policy that applied.
+// When limited is false, the series is reserved even if the vector is full.
+//
+// It must not be called holding the lock of a shard, since it may evict metrics.
+func (mv *MetricVec[M]) reserve(limited bool) (bool, LimitPolicy) {
+	for {
+		count := atomic.LoadInt64(&mv.seriesCount)
+		if maxSeries := mv.tunables.getMaxSeries(); limited && maxSeries > 0 && count >= int64(maxSeries) {
+			policy := mv.tunables.getLimitPolicy()
+			if policy != LimitEvictLeastActive || !mv.evictLeastActive() {
+				return false, policy
+			}
+			continue
+		}
+		if atomic.CompareAndSwapInt64(&mv.seriesCount, count, count+1) {
+			break
+		}
+	}
+	if budget := mv.opts.Budget; budget != nil {
+		if !limited {
+			budget.forceAcquire()
+		} else if !budget.acquire(mv) {
+			atomic.AddInt64(&mv.seriesCount, -1)
+			return false, budget.policy
+		}
+	}
+	return true, mv.tunables.getLimitPolicy()
+}
+
+// release gives back series reserved by the vector.
+func (mv *MetricVec[M]) release(count int) {
+	if count <= 0 {
+		return
+	}
+	atomic.AddInt64(&mv.seriesCount, -int64(count))
+	if mv.opts.Budget != nil {
+		mv.opts.Budget.release(count)
+	}
+}
+
+// accessEntry is the last access of a metric in an accessQueue.
+type accessEntry struct {
+	lastAccess int64
+	attr       *metricAttr
+}
+
+// accessQueue is a min-heap of the last accesses of the exported metrics of a shard, so that finding the least active
+// metric does not require visiting all the metrics.
+//
+// Like in the expiryQueue, the last access of an entry may be earlier than the actual last access of its metric, since
+// accessing a metric does not update the queue: the entry is fixed when it reaches the top of the queue. A metric
+// has at most one entry, whose index is kept in the attributes of the metric.
+type accessQueue []accessEntry
+
+func (q accessQueue) Len() int           { return len(q) }
+func (q accessQueue) Less(i, j int) bool { return q[i].lastAccess < q[j].lastAccess }
+
+func (q accessQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].attr.accessIndex = i
+	q[j].attr.accessIndex = j
+}
+
+func (q *accessQueue) Push(x any) {
+	entry := x.(accessEntry)
+	entry.attr.accessQueued = true
+	entry.attr.accessIndex = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *accessQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	entry.attr.accessQueued = false
+	old[len(old)-1] = accessEntry{}
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// must be called holding shard.mutex.Lock
+func (s *metricShard) queueAccess(attr *metricAttr) {
+	if !attr.accessQueued {
+		heap.Push(&s.accesses, accessEntry{lastAccess: atomic.LoadInt64(&attr.lastAccess), attr: attr})
+	}
+}
+
+// must be called holding shard.mutex.Lock
+func (s *metricShard) dequeueAccess(attr *metricAttr) {
+	if attr.accessQueued {
+		heap.Remove(&s.accesses, attr.accessIndex)
+	}
+}
+
+// must be called holding shard.mutex.Lock
+//
+// leastActive returns the least recently accessed exported metric of the shard and its last access, fixing the
+// entries of the queue that are out of date on the way. No metric is accessed meanwhile since the write lock is held,
+// and each entry is fixed at most once per access of its metric.
+func (s *metricShard) leastActive() (*metricAttr, int64) {
+	for len(s.accesses) > 0 {
+		entry := &s.accesses[0]
+		lastAccess := atomic.LoadInt64(&entry.attr.lastAccess)
+		if lastAccess == entry.lastAccess {
+			return entry.attr, lastAccess
+		}
+		entry.lastAccess = lastAccess
+		heap.Fix(&s.accesses, 0)
+	}
+	return nil, 0
+}
+
+// evictLeastActive evicts the least recently accessed metric of the vector.
+// It returns false when the vector has no metric to evict.
+//
+// It must not be called holding the lock of a shard.
+func (mv *MetricVec[M]) evictLeastActive() bool {
+	var leastActive *metricAttr
+	var leastActiveShard *metricShard
+	var leastAccess int64
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.Lock()
+		attr, lastAccess := shard.leastActive()
+		shard.mutex.Unlock()
+		if attr != nil && (leastActive == nil || lastAccess < leastAccess) {
+			leastActive, leastActiveShard, leastAccess = attr, shard, lastAccess
+		}
+	}
+	if leastActive == nil {
+		return false
+	}
+	// The metric may have been removed meanwhile, which frees a series as well.
+	leastActiveShard.mutex.Lock()
+	defer leastActiveShard.mutex.Unlock()
+	if elem := leastActiveShard.tags.getElem(leastActive.hash, leastActive.labelValues); elem != nil && elem.attr == leastActive {
+		mv.deleteMetricByInstance(leastActiveShard, elem.metric, removalEvicted)
+	}
+	return true
+}
+
+func (mv *MetricVec[M]) budgetPriority() int {
+	return mv.opts.BudgetPriority
+}
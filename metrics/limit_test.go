@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_LimitReject(t *testing.T) {
+	t.Parallel()
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock:      metricstest.NewFakeClock(defaultTime),
+		VectorOpts: VectorOpts{MaxSeries: 2},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+
+	metric, err := counter.GetMetricWithLabelValues("tata")
+	assert.ErrorIs(t, err, ErrSeriesLimitReached)
+	assert.Nil(t, metric)
+	assert.Panics(t, func() { counter.WithLabelValues("tata") })
+
+	// existing metrics are still available
+	_, err = counter.GetMetricWithLabelValues("toto")
+	assert.NoError(t, err)
+
+	// deleting a metric makes room for a new one
+	counter.DeleteLabelValues("titi")
+	_, err = counter.GetMetricWithLabelValues("tata")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_LimitEvictLeastActive(t *testing.T) {
+	t.Parallel()
+
+	t0 := defaultTime
+	clock := metricstest.NewFakeClock(t0)
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		RollupLabels: prometheus.Labels{"label": "__evicted__"},
+		Clock:        clock,
+		VectorOpts: VectorOpts{
+			MaxSeries:   2,
+			LimitPolicy: LimitEvictLeastActive,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Add(1)
+	clock.Set(t0.Add(time.Millisecond))
+	counter.WithLabelValues("titi").Add(2)
+	clock.Set(t0.Add(2 * time.Millisecond))
+	counter.WithLabelValues("toto").Add(3)
+
+	// titi is the least recently accessed metric, the tags of the metrics created after
+	// its eviction differ from its tag even within the same second
+	clock.Set(t0.Add(3 * time.Millisecond))
+	counter.WithLabelValues("tata").Add(4)
+	// the evicted metric comes back and toto is evicted in turn
+	counter.WithLabelValues("titi").Add(5)
+
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9775",label="titi"} 0
+		namespace_something_count{_tag_="48ab9775",label="tata"} 0
+		namespace_something_count{_tag_="48ab9774",label="__evicted__"} 6
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_EvictLeastActiveOrder(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := NewCounterVec(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Clock:       clock,
+		VectorOpts:  VectorOpts{MaxSeries: 100, LimitPolicy: LimitEvictLeastActive},
+	}, []string{"label"})
+	for i := 0; i < 100; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+		clock.Advance(time.Millisecond)
+	}
+	// access the metrics again in another order: i*37%100 is a permutation
+	for i := 0; i < 100; i++ {
+		counter.WithLabelValues(strconv.Itoa(i * 37 % 100)).Inc()
+		clock.Advance(time.Millisecond)
+	}
+
+	exists := func(label string) bool {
+		for _, series := range counter.Inspect() {
+			if series.LabelValues[0] == label {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the new metrics evict the metrics by order of last access
+	for i := 0; i < 10; i++ {
+		counter.WithLabelValues("new" + strconv.Itoa(i)).Inc()
+		clock.Advance(time.Millisecond)
+		assert.Equal(t, 100, counter.countMetrics())
+		assert.False(t, exists(strconv.Itoa(i*37%100)), i)
+	}
+	assert.True(t, exists(strconv.Itoa(10*37%100)))
+}
@@ -1,8 +1,14 @@
 package metrics
 
+import "github.com/prometheus/client_golang/prometheus"
+
+// mapElement is an entry of a tagMap. For the tag maps of a MetricVec, it also holds the metric
+// carrying the tag and its attributes, so that looking up a live metric takes a single hash.
 type mapElement struct {
-	key   []string
-	value string
+	key    []string
+	value  string
+	metric prometheus.Metric
+	attr   *metricAttr
 }
 
 type tagMap struct {
@@ -18,26 +24,44 @@ func newTagMap() *tagMap {
 }
 
 func (m *tagMap) Add(key []string, value string) {
-	hash := m.hash(key)
-	i := m.findElem(hash, key)
-	if i >= 0 {
-		m.index[hash][i].value = value
-		return
-	}
-	m.index[hash] = append(m.index[hash], mapElement{key, value})
+	m.addElem(m.hash(key), mapElement{key: key, value: value})
 }
 
 func (m *tagMap) Get(key []string) (string, bool) {
-	hash := m.hash(key)
-	i := m.findElem(hash, key)
-	if i >= 0 {
-		return m.index[hash][i].value, true
+	if elem := m.getElem(m.hash(key), key); elem != nil {
+		return elem.value, true
 	}
 	return "", false
 }
 
 func (m *tagMap) Delete(key []string) {
-	hash := m.hash(key)
+	m.deleteElem(m.hash(key), key)
+}
+
+// addElem adds or replaces the element of the given key, whose hash was already computed.
+func (m *tagMap) addElem(hash uint64, elem mapElement) {
+	i := m.findElem(hash, elem.key)
+	if i >= 0 {
+		m.index[hash][i] = elem
+		return
+	}
+	m.index[hash] = append(m.index[hash], elem)
+}
+
+// getElem returns the element of the given key, whose hash was already computed, or nil if it is not present.
+// The returned element is only valid till the next modification of the map.
+func (m *tagMap) getElem(hash uint64, key []string) *mapElement {
+	elems := m.index[hash]
+	for i := range elems {
+		if equalStrings(key, elems[i].key) {
+			return &elems[i]
+		}
+	}
+	return nil
+}
+
+// deleteElem deletes the element of the given key, whose hash was already computed.
+func (m *tagMap) deleteElem(hash uint64, key []string) {
 	i := m.findElem(hash, key)
 	if i >= 0 {
 		list := m.index[hash]
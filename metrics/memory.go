@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Approximate sizes of the structures held for each metric of a vector, in bytes.
+const (
+	stringHeaderBytes = int64(unsafe.Sizeof(""))
+	pointerBytes      = int64(unsafe.Sizeof(uintptr(0)))
+	sliceHeaderBytes  = int64(unsafe.Sizeof([]string(nil)))
+	// entry of the metricAttrs map: interface key and pointer value
+	attrEntryBytes = int64(unsafe.Sizeof(prometheus.Metric(nil))) + pointerBytes
+	// entry of the tag map
+	mapElementBytes = int64(unsafe.Sizeof(mapElement{}))
+	// entry of the underlying prometheus vector: label values and metric
+	vecEntryBytes    = sliceHeaderBytes + int64(unsafe.Sizeof(prometheus.Metric(nil)))
+	metricAttrBytes  = int64(unsafe.Sizeof(metricAttr{}))
+	expiryEntryBytes = int64(unsafe.Sizeof(expiryEntry{}))
+	// entry of the candidates map: hash and candidate
+	candidateEntryBytes = int64(unsafe.Sizeof(uint64(0)) + unsafe.Sizeof(admissionCandidate{}))
+)
+
+// each variable label of a metric is written by the prometheus metrics as a dto.LabelPair with pointers to its name and value
+var labelPairBytes = pointerBytes + int64(reflect.TypeOf(dto.LabelPair{}).Size()) + 2*stringHeaderBytes
+
+// MemoryBytes returns an estimate of the memory used by the metrics of the vector, in bytes. It includes the metrics
+// themselves (not the memory they reference, like the buckets of histograms), their label values, and the
+// bookkeeping of both this vector and the underlying prometheus vector. The label values stored by an Interner are not
+// included (see Interner.MemoryBytes), neither are the rollup series.
+func (mv *MetricVec[M]) MemoryBytes() int64 {
+	var total int64
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.RLock()
+		for metric, attr := range shard.metricAttrs {
+			total += mv.metricBytes(metric, attr)
+		}
+		total += int64(len(shard.candidates)) * candidateEntryBytes
+		total += int64(cap(shard.expiries)) * expiryEntryBytes
+		shard.mutex.RUnlock()
+	}
+	return total
+}
+
+func (mv *MetricVec[M]) metricBytes(metric prometheus.Metric, attr *metricAttr) int64 {
+	labelCount := int64(len(attr.taggedValues))
+	size := metricAttrBytes + attrEntryBytes + mapElementBytes + vecEntryBytes
+	// the label values are held by the attributes and copied by the underlying vector
+	size += 2 * labelCount * stringHeaderBytes
+	size += labelCount * labelPairBytes
+	if t := reflect.TypeOf(metric); t.Kind() == reflect.Ptr {
+		size += int64(t.Elem().Size())
+	}
+	if mv.opts.Interner == nil {
+		for _, value := range attr.taggedValues {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
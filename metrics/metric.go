@@ -3,17 +3,86 @@ package metrics
 import (
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-const labelLifeCycleTag = "_tag_"
+// LabelLifeCycleTag is the name of the internal label added to the metrics of the vectors, whose value changes
+// when a new life cycle of the metric starts (see MetricVec).
+const LabelLifeCycleTag = "_tag_"
 
 type metricOpts struct {
+	// FQName is the fully-qualified name of the metric
+	FQName string
+	// ConstLabels are the constant labels of the metric, identifying the vector in its statistics along with FQName
+	ConstLabels     prometheus.Labels
 	InitialMetric   func(metric prometheus.Metric, labelValues []string) prometheus.Metric
 	WarmUpDuration  time.Duration
 	ExpirationDelay time.Duration
+	RollupLabels    prometheus.Labels
+	NewRollup       func() rollupAccumulator
+	Clock           Clock
+	VectorOpts
+}
+
+// VectorOpts bundles the options that are only applicable to vector of metrics.
+type VectorOpts struct {
+	// AdmissionThreshold is the number of times a set of label values must be accessed within AdmissionWindow
+	// before the corresponding metric is created. Till then, only the number of accesses of the label values is kept,
+	// and the accesses return the overflow metric (see OverflowValue), so that the updates of the label values pending
+	// admission are counted in the overflow series. Zero or one means that every metric is admitted directly.
+	AdmissionThreshold int
+	// AdmissionWindow is the maximum time a set of label values waits for its admission since it was first accessed.
+	// Past this delay its accesses are forgotten and it starts a new admission cycle when accessed again. Zero value
+	// means 1 minute: the window bounds the number of label values pending admission, e.g. the label values of
+	// scanners or typos that are accessed only once.
+	AdmissionWindow time.Duration
+	// MaxSeries is the maximum number of metrics exported by the vector.
+	// Zero value means no limit.
+	MaxSeries int
+	// LimitPolicy defines how the vector behaves when a new metric would exceed MaxSeries.
+	LimitPolicy LimitPolicy
+	// OverflowValue is the value of all the labels of the overflow metric used by the LimitOverflow policy and by the
+	// label values pending admission ("__overflow__" by default).
+	OverflowValue string
+	// Budget is a maximum number of series shared with other vectors, in addition to MaxSeries.
+	// When the budget is exhausted, its own limit policy applies.
+	Budget *Budget
+	// BudgetPriority is the priority of the vector in its budget. When the budget policy is LimitEvictLeastActive,
+	// a vector can only evict metrics from the vectors with a lower or equal priority.
+	BudgetPriority int
+	// TopK enables the top-K mode of the vector when greater than zero: only the TopK sets of label values with the
+	// highest activity (number of accesses) are exported as individual metrics. The other ones are folded into a single
+	// "other" metric whose label values are all set to TopKOtherValue.
+	// The metrics that drop out of the top-K are removed and start a new life cycle when they come back; for counters and
+	// histograms, their values are folded into a new "other" series so that they are not lost.
+	// The activity is tracked in a bounded memory, so the least active label values may be slightly mis-ranked, and
+	// the top-K is recomputed at the first access or collection after the end of each TopKInterval.
+	TopK int
+	// TopKInterval is the period at which the top-K is recomputed from the activity of the past period (1 minute by default).
+	TopKInterval time.Duration
+	// TopKOtherValue is the value of all the labels of the "other" metric ("__other__" by default).
+	TopKOtherValue string
+	// Interner stores the label values of the metrics once for all the vectors sharing it.
+	// By default, each metric refers to the label values given at its creation.
+	Interner *Interner
+	// Stats reports the statistics of the vector (number of series, life cycles, collection duration...)
+	// along with the other vectors sharing it. No statistics are reported by default.
+	Stats *StatsCollector
+	// Observer is notified of the creation of the vector, e.g. a promhttp.AdminHandler.
+	Observer VectorObserver
+	// LabelTTLs override the expiration delay of the metrics having some label values, e.g. a short delay for the
+	// series of the batch jobs. The first rule matching the label values of a new metric gives its expiration delay for
+	// its whole life cycle, regardless of SetExpirationDelay. The rules having a label that is not a label of the vector
+	// are ignored.
+	LabelTTLs []LabelTTL
+	// TagGenerator generates the life cycle tags of the metrics (see LabelLifeCycleTag) instead of the default
+	// hexadecimal timestamps, e.g. to make them unique across the instances of an exporter. It is called with the time
+	// and the label values of the new metric (which must not be modified), and it must return a different tag for each
+	// new life cycle of the same label values.
+	TagGenerator func(now time.Time, labelValues []string) string
 }
 
 type metricState uint32
@@ -22,58 +91,89 @@ const (
 	stateWarmUpPending metricState = iota
 	stateWarmUpOngoing
 	stateWarmUpComplete
-	stateExpired
 )
 
+// metricAttr holds the state of a metric. The state that changes on access or collection is accessed atomically,
+// so that neither accessing nor collecting a metric takes a lock per metric.
 type metricAttr struct {
-	tag            string
-	labelValues    []string
-	state          metricState
-	stateMutex     sync.Mutex
-	warmUpDeadLine time.Time
-	activeDeadLine time.Time
+	// the 64-bit fields accessed atomically come first to be aligned on 32-bit platforms
+	// time of the last access, in unix nanoseconds
+	lastAccess int64
+	// start of the warm-up, in unix nanoseconds
+	warmUpStart int64
+	// state of the warm-up, a metricState
+	state uint32
+
+	tag         string
+	labelValues []string
+	// label values followed by the tag, i.e. the label values of the metric in the underlying vector
+	taggedValues []string
+	// hash of labelValues
+	hash uint64
+	// the following fields are guarded by the lock of the shard of the metric
+	// true when the metric has an entry in the expiry queue of its shard, at index queueIndex
+	queued     bool
+	queueIndex int
+	// true when the metric has an entry in the access queue of its shard, at index accessIndex
+	accessQueued bool
+	accessIndex  int
+	// expiration delay given by a LabelTTL rule, when hasTTL is true
+	ttl    time.Duration
+	hasTTL bool
 }
 
-func (a *metricAttr) hasExpired() bool {
-	a.stateMutex.Lock()
-	defer a.stateMutex.Unlock()
-	return a.state == stateExpired
+// onCollect updates the warm-up state of the metric on collection and returns the new state.
+// completed is true when the warm-up of the metric completed with this call.
+//
+// The end of the warm-up is computed from the given duration on each call, so that a change of the warm-up duration
+// applies to the metrics whose warm-up is ongoing.
+func (a *metricAttr) onCollect(now time.Time, warmUpDuration time.Duration) (state metricState, completed bool) {
+	state = metricState(atomic.LoadUint32(&a.state))
+	switch state {
+	case stateWarmUpPending:
+		atomic.StoreInt64(&a.warmUpStart, now.UnixNano())
+		atomic.CompareAndSwapUint32(&a.state, uint32(stateWarmUpPending), uint32(stateWarmUpOngoing))
+		return stateWarmUpOngoing, false
+	case stateWarmUpOngoing:
+		if now.UnixNano() > atomic.LoadInt64(&a.warmUpStart)+int64(warmUpDuration) {
+			completed = atomic.CompareAndSwapUint32(&a.state, uint32(stateWarmUpOngoing), uint32(stateWarmUpComplete))
+			return stateWarmUpComplete, completed
+		}
+	}
+	return state, false
 }
 
-func (a *metricAttr) onCollect(warmUpDuration time.Duration) metricState {
-	a.stateMutex.Lock()
-	defer a.stateMutex.Unlock()
-	nowTime := nowFunc()
-	if a.state == stateWarmUpPending {
-		a.warmUpDeadLine = nowTime.Add(warmUpDuration)
-		a.state = stateWarmUpOngoing
-	} else if a.state == stateWarmUpOngoing && nowTime.After(a.warmUpDeadLine) {
-		a.state = stateWarmUpComplete
-	} else if a.state == stateWarmUpComplete && !a.activeDeadLine.IsZero() && nowTime.After(a.activeDeadLine) {
-		a.state = stateExpired
-	}
-	return a.state
+func (a *metricAttr) warmUpComplete() bool {
+	return metricState(atomic.LoadUint32(&a.state)) == stateWarmUpComplete
 }
 
-func (a *metricAttr) onAccess(expirationDelay time.Duration) {
-	a.stateMutex.Lock()
-	defer a.stateMutex.Unlock()
-	if expirationDelay > 0 {
-		a.activeDeadLine = nowFunc().Add(expirationDelay)
-	}
+func (a *metricAttr) onAccess(now time.Time) {
+	atomic.StoreInt64(&a.lastAccess, now.UnixNano())
+}
+
+func (a *metricAttr) getLastAccess() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&a.lastAccess))
 }
 
 type singleCollector struct {
+	// warm-up duration, accessed atomically, see SetWarmUpDuration
+	warmUpDuration int64
+	// non-zero when the metric is disabled, accessed atomically, see SetEnabled
+	disabled int32
+
 	metric prometheus.Metric
 	attr   *metricAttr
 	opts   metricOpts
+	clock  Clock
 }
 
 func newSingleCollector(metric prometheus.Metric, opts metricOpts) *singleCollector {
 	return &singleCollector{
-		metric: metric,
-		attr:   &metricAttr{},
-		opts:   opts,
+		warmUpDuration: int64(opts.WarmUpDuration),
+		metric:         metric,
+		attr:           &metricAttr{},
+		opts:           opts,
+		clock:          clockOrDefault(opts.Clock),
 	}
 }
 
@@ -81,7 +181,10 @@ func newSingleCollector(metric prometheus.Metric, opts metricOpts) *singleCollec
 // It handles the metrics warm-up and returns the initial value instead of the actual metric value
 // till the warm-up delay has passed.
 func (c *singleCollector) Collect(ch chan<- prometheus.Metric) {
-	state := c.attr.onCollect(c.opts.WarmUpDuration)
+	if atomic.LoadInt32(&c.disabled) != 0 {
+		return
+	}
+	state, _ := c.attr.onCollect(c.clock.Now(), time.Duration(atomic.LoadInt64(&c.warmUpDuration)))
 	if state == stateWarmUpOngoing {
 		ch <- c.opts.InitialMetric(c.metric, c.attr.labelValues)
 	} else {
@@ -89,10 +192,30 @@ func (c *singleCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-// generateLifeCycleTag generates a value for the internal label lifeCycleTag that is added as time series labels.
-// It makes sure we produce different value over the time.
-func generateLifeCycleTag() string {
-	return strconv.FormatInt(nowFunc().Unix(), 16)
+// shardCount is the number of shards of a MetricVec, it must be a power of 2.
+const shardCount = 16
+
+// metricShard holds the metrics of a MetricVec whose label values hash to the shard.
+type metricShard struct {
+	metricAttrs map[prometheus.Metric]*metricAttr
+	// label values pending admission, by hash, see AdmissionThreshold
+	candidates map[uint64]admissionCandidate
+	tags       *tagMap
+	// deadlines of the metrics that can expire
+	expiries expiryQueue
+	// last accesses of the exported metrics, to find the least active one
+	accesses accessQueue
+	mutex    sync.RWMutex
+}
+
+func (s *metricShard) init() {
+	// using prometheus.Metric as key will only work when the underlying implementation use pointer receiver on struct
+	// (the interface must be comparable). Fortunately this is the case for all basic metric types of prometheus library.
+	s.metricAttrs = make(map[prometheus.Metric]*metricAttr)
+	s.candidates = make(map[uint64]admissionCandidate)
+	s.tags = newTagMap()
+	s.expiries = nil
+	s.accesses = nil
 }
 
 // MetricVec is a generic implementation of a Vector of metrics, to bundle metrics of the same name that differ in
@@ -101,102 +224,358 @@ func generateLifeCycleTag() string {
 //
 // The available operations are the same as [prometheus.MetricVec] expect for the Curry operation that is not implemented.
 //
+// The metrics are partitioned in shards by the hash of their label values, each shard having its own lock,
+// so that concurrent operations on different label values rarely contend.
+//
 // You should not instantiate directly this struct
 type MetricVec[M prometheus.Metric] struct {
-	metricVec   *prometheus.MetricVec
-	labelNames  []string
-	opts        metricOpts
-	metricAttrs map[prometheus.Metric]*metricAttr
-	tags        *tagMap
-	mutex       sync.RWMutex
+	// number of exported metrics, accessed atomically
+	seriesCount int64
+	// minimum value of the next life cycle tags, accessed atomically, see newLifeCycleTag
+	minTag int64
+	// maximum value of the life cycle tags generated so far, guarded by tagMutex, see newOtherRollupTag
+	maxTag int64
+	// statistics of the vector, accessed atomically, see StatsCollector
+	counters vectorCounters
+	// options that can be changed at runtime, accessed atomically, see SetWarmUpDuration for instance
+	tunables tunables
+	// non-zero when the vector is disabled, accessed atomically, see SetEnabled
+	disabled int32
+
+	// name and constant labels of the vector, see ID
+	id         string
+	metricVec  *prometheus.MetricVec
+	labelNames []string
+	opts       metricOpts
+	shards     [shardCount]metricShard
+	rollups    *rollupMap
+	topK       *topKTracker
+	// the values of the metrics that dropped out of the top-K, folded into "other" series
+	topKRollups *rollupMap
+	// label values of the overflow metric, see LimitOverflow
+	overflowValues []string
+	// LabelTTLs of the options, resolved against the labels of the vector
+	labelTTLs   []labelTTLRule
+	quarantines quarantineList
+	// metric returned to all the accesses while the vector is disabled, see SetEnabled
+	discard prometheus.Metric
+	clock   Clock
+	// stops the scheduled clean-up of the expired metrics, nil when not scheduled
+	stopCleanUp  func() bool
+	cleanUpMutex sync.Mutex
+	// serializes the generation of the default life cycle tags
+	tagMutex sync.Mutex
 }
 
 func newMetricVec[M prometheus.Metric](vecFactory func(labelNames []string) *prometheus.MetricVec, opts metricOpts, labelNames []string) *MetricVec[M] {
-	// Add the internal label labelLifeCycleTag at the end of the list of labels
+	// Add the internal label LabelLifeCycleTag at the end of the list of labels
 	// This is an extra label managed internally to avoid label collision with expired metrics.
 	allLabelNames := make([]string, len(labelNames)+1)
 	copy(allLabelNames, labelNames)
-	allLabelNames[len(labelNames)] = labelLifeCycleTag
+	allLabelNames[len(labelNames)] = LabelLifeCycleTag
 	vec := vecFactory(allLabelNames)
+	clock := clockOrDefault(opts.Clock)
+	if opts.AdmissionThreshold > 1 && opts.AdmissionWindow <= 0 {
+		opts.AdmissionWindow = defaultAdmissionWindow
+	}
+
+	var rollups *rollupMap
+	if len(opts.RollupLabels) > 0 && opts.NewRollup != nil {
+		rollups = newRollupMap(labelNames, opts.RollupLabels, opts.NewRollup)
+	}
 
-	return &MetricVec[M]{
-		metricVec:  vec,
-		labelNames: allLabelNames[:len(labelNames)],
-		opts:       opts,
-		// using prometheus.Metric as key will only work when the underlying implementation use pointer receiver on struct
-		// (the interface must be comparable). Fortunately this is the case for all basic metric types of prometheus library.
-		metricAttrs: make(map[prometheus.Metric]*metricAttr),
-		tags:        newTagMap(),
+	var topK *topKTracker
+	var topKRollups *rollupMap
+	if opts.TopK > 0 {
+		topK = newTopKTracker(opts.VectorOpts, len(labelNames), clock.Now())
+		if opts.NewRollup != nil {
+			otherLabels := make(prometheus.Labels, len(labelNames))
+			for i, name := range labelNames {
+				otherLabels[name] = topK.otherValues[i]
+			}
+			topKRollups = newRollupMap(labelNames, otherLabels, opts.NewRollup)
+		}
 	}
+
+	overflowValue := opts.OverflowValue
+	if overflowValue == "" {
+		overflowValue = defaultOverflowValue
+	}
+	overflowValues := make([]string, len(labelNames))
+	for i := range overflowValues {
+		overflowValues[i] = overflowValue
+	}
+
+	mv := &MetricVec[M]{
+		id:             ID(opts.FQName, opts.ConstLabels),
+		tunables:       newTunables(opts),
+		metricVec:      vec,
+		labelNames:     allLabelNames[:len(labelNames)],
+		opts:           opts,
+		rollups:        rollups,
+		topK:           topK,
+		topKRollups:    topKRollups,
+		overflowValues: overflowValues,
+		labelTTLs:      newLabelTTLRules(labelNames, opts.LabelTTLs),
+		clock:          clock,
+	}
+	for i := range mv.shards {
+		mv.shards[i].init()
+	}
+	if opts.Budget != nil {
+		opts.Budget.register(mv)
+	}
+	if opts.Stats != nil {
+		opts.Stats.register(mv)
+	}
+	if opts.Observer != nil {
+		opts.Observer.AddVector(mv)
+	}
+	return mv
 }
 
-// must be called holding mv.mutex.RLock or mv.mutex.Lock
-func (mv *MetricVec[M]) getMetric(labelValues ...string) (prometheus.Metric, error) {
-	tag, present := mv.tags.Get(labelValues)
-	if !present {
-		return nil, nil
+// Detach removes the vector from the Budget, StatsCollector and Observer of its options, e.g. when it is unregistered.
+// The vector is disabled (see SetEnabled), so that its series are given back to the Budget and it does not draw
+// series from it anymore; it should not be used afterwards.
+func (mv *MetricVec[M]) Detach() {
+	mv.SetEnabled(false)
+	if mv.opts.Budget != nil {
+		mv.opts.Budget.unregister(mv)
 	}
-	metric, err := mv.metricVec.GetMetricWithLabelValues(append(labelValues, tag)...)
-	if err != nil {
-		return metric, err
+	if mv.opts.Stats != nil {
+		mv.opts.Stats.unregister(mv)
 	}
-	attr := mv.metricAttrs[metric]
-	if attr == nil || attr.hasExpired() {
-		return nil, nil
+	if mv.opts.Observer != nil {
+		mv.opts.Observer.RemoveVector(mv)
+	}
+}
+
+func (mv *MetricVec[M]) shard(hash uint64) *metricShard {
+	return &mv.shards[hash&(shardCount-1)]
+}
+
+// must be called holding shard.mutex.RLock or shard.mutex.Lock
+//
+// getMetric returns the live metric of the given label values, or nil if there is none.
+// It only hashes the label values once (the hash is given by the caller) and does not allocate.
+func (mv *MetricVec[M]) getMetric(shard *metricShard, hash uint64, labelValues []string) prometheus.Metric {
+	elem := shard.tags.getElem(hash, labelValues)
+	if elem == nil {
+		return nil
+	}
+	// Postpone the expiration
+	elem.attr.onAccess(mv.clock.Now())
+	return elem.metric
+}
+
+// getOrAddMetric returns the metric of the given label values, creating it if needed.
+// When limited is false, the metric is created even if the vector is full.
+func (mv *MetricVec[M]) getOrAddMetric(labelValues []string, limited bool) (prometheus.Metric, error) {
+	hash := hashStringSlice(labelValues)
+	shard := mv.shard(hash)
+
+	// First try to get an existing metric with Read lock only
+	shard.mutex.RLock()
+	metric := mv.getMetric(shard, hash, labelValues)
+	shard.mutex.RUnlock()
+	if metric != nil {
+		return metric, nil
+	}
+
+	if mv.quarantined(labelValues) {
+		return mv.detachedMetric(labelValues)
+	}
+	// The updates of the label values pending admission are counted in the overflow metric
+	if limited && mv.opts.AdmissionThreshold > 1 && len(labelValues) == len(mv.labelNames) && !mv.admit(shard, hash, labelValues) {
+		return mv.getOrAddMetric(mv.overflowValues, false)
+	}
+
+	// The metric was not found: first reserve a series for it (which may evict other metrics),
+	// then take a write lock to create it.
+	if ok, policy := mv.reserve(limited); !ok {
+		if policy == LimitOverflow {
+			return mv.getOrAddMetric(mv.overflowValues, false)
+		}
+		return nil, ErrSeriesLimitReached
+	}
+	var err error
+	created := false
+	shard.mutex.Lock()
+	metric = mv.getMetric(shard, hash, labelValues) // a metric may still have been created between the two locks
+	if metric == nil {
+		metric, err = mv.addMetric(shard, hash, labelValues)
+		created = err == nil
+	}
+	shard.mutex.Unlock()
+	if !created {
+		mv.release(1)
+	}
+	if err != nil {
+		return nil, err
 	}
-	// Schedule the expiration time
-	attr.onAccess(mv.opts.ExpirationDelay)
 	return metric, nil
 }
 
-// must be called holding mv.mutex.Lock
-func (mv *MetricVec[M]) addMetric(labelValues ...string) (prometheus.Metric, error) {
+// must be called holding shard.mutex.Lock
+//
+// A series must have been reserved for the metric.
+func (mv *MetricVec[M]) addMetric(shard *metricShard, hash uint64, labelValues []string) (prometheus.Metric, error) {
+	// An expired metric with the same label values may still be present till the next clean-up,
+	// remove it first so that it cannot be confused with the new one.
+	mv.deleteMetric(shard, hash, labelValues, removalExpired)
+
 	// When adding a new metric in the vector we generate a new tag.
-	// This tag will be the value of the internal label labelLifeCycleTag till the expiration of the metric.
-	tag := generateLifeCycleTag()
-	metric, err := mv.metricVec.GetMetricWithLabelValues(append(labelValues, tag)...)
+	// This tag will be the value of the internal label LabelLifeCycleTag till the expiration of the metric.
+	// The label values are copied, so that the metric never refers to the slice of the caller.
+	taggedValues := make([]string, len(labelValues)+1)
+	copy(taggedValues, labelValues)
+	// the copy is given to the tag generator, so that the label values of the caller do not escape
+	tag := mv.newLifeCycleTag(taggedValues[:len(labelValues)])
+	taggedValues[len(labelValues)] = tag
+	if mv.opts.Interner != nil {
+		mv.opts.Interner.intern(taggedValues)
+	}
+	metric, err := mv.metricVec.GetMetricWithLabelValues(taggedValues...)
 	if err != nil {
+		if mv.opts.Interner != nil {
+			mv.opts.Interner.release(taggedValues)
+		}
 		return metric, err
 	}
-	mv.tags.Add(labelValues, tag)
 
-	attr := &metricAttr{tag: tag, labelValues: labelValues}
-	// Schedule the expiration time
-	attr.onAccess(mv.opts.ExpirationDelay)
-	mv.metricAttrs[metric] = attr
+	now := mv.clock.Now()
+	attr := &metricAttr{
+		tag:          tag,
+		labelValues:  taggedValues[:len(labelValues):len(labelValues)],
+		taggedValues: taggedValues,
+		hash:         hash,
+	}
+	attr.ttl, attr.hasTTL = mv.labelTTL(attr.labelValues)
+	attr.onAccess(now)
+	shard.metricAttrs[metric] = attr
+	shard.queueAccess(attr)
+	shard.tags.addElem(hash, mapElement{key: attr.labelValues, value: tag, metric: metric, attr: attr})
+	mv.queueExpiry(shard, attr)
+	mv.scheduleCleanUp()
+	atomic.AddInt64(&mv.counters.created, 1)
 	return metric, nil
 }
 
-// must be called holding mv.mutex.Lock
-func (mv *MetricVec[M]) deleteMetric(labelValues ...string) bool {
-	tag, present := mv.tags.Get(labelValues)
-	if !present {
+// must be called holding shard.mutex.Lock
+func (mv *MetricVec[M]) deleteAttr(shard *metricShard, metric prometheus.Metric) {
+	if attr, found := shard.metricAttrs[metric]; found {
+		delete(shard.metricAttrs, metric)
+		shard.dequeueAccess(attr)
+		mv.release(1)
+	}
+}
+
+// must be called holding shard.mutex.Lock
+func (mv *MetricVec[M]) deleteMetric(shard *metricShard, hash uint64, labelValues []string, reason removalReason) bool {
+	elem := shard.tags.getElem(hash, labelValues)
+	if elem == nil {
 		return false
 	}
-	metric, _ := mv.metricVec.GetMetricWithLabelValues(append(labelValues, tag)...)
-	mv.tags.Delete(labelValues)
-	delete(mv.metricAttrs, metric)
-	mv.metricVec.DeleteLabelValues(append(labelValues, tag)...)
-	return true
+	return mv.deleteMetricByInstance(shard, elem.metric, reason)
 }
 
-// must be called holding mv.mutex.Lock
-func (mv *MetricVec[M]) deleteMetricByInstance(metric prometheus.Metric) bool {
-	attr := mv.metricAttrs[metric]
+// must be called holding shard.mutex.Lock
+func (mv *MetricVec[M]) deleteMetricByInstance(shard *metricShard, metric prometheus.Metric, reason removalReason) bool {
+	attr := shard.metricAttrs[metric]
 	if attr == nil {
 		return false
 	}
-	mv.metricVec.DeleteLabelValues(append(attr.labelValues, attr.tag)...)
-	delete(mv.metricAttrs, metric)
-	tag, present := mv.tags.Get(attr.labelValues)
-	// if the deleted metric has expired it is possible that attr.tag differs from
-	// the current tag (if a metric with the same label was added againg)
-	if present && tag == attr.tag {
-		mv.tags.Delete(attr.labelValues)
+	mv.counters.onRemoval(reason)
+	mv.rollupMetric(metric, attr.labelValues, reason)
+	mv.retireLifeCycleTag(attr.tag)
+	mv.metricVec.DeleteLabelValues(attr.taggedValues...)
+	mv.deleteAttr(shard, metric)
+	mv.dequeueExpiry(shard, attr)
+	if mv.opts.Interner != nil {
+		mv.opts.Interner.release(attr.taggedValues)
+	}
+	// if the deleted metric has expired it is possible that the label values now refer to
+	// another metric (if a metric with the same label was added againg)
+	if elem := shard.tags.getElem(attr.hash, attr.labelValues); elem != nil && elem.attr == attr {
+		shard.tags.deleteElem(attr.hash, attr.labelValues)
 	}
 	return true
 }
 
+// newLifeCycleTag generates the tag of a new metric. It never returns the tag of a metric removed from the vector,
+// so that a metric removed and added again within the same second still starts a new time series.
+// The tags of a TagGenerator are used as is.
+func (mv *MetricVec[M]) newLifeCycleTag(labelValues []string) string {
+	if mv.opts.TagGenerator != nil {
+		return mv.opts.TagGenerator(mv.clock.Now(), labelValues)
+	}
+	mv.tagMutex.Lock()
+	defer mv.tagMutex.Unlock()
+	tag := mv.clock.Now().Unix()
+	if minTag := atomic.LoadInt64(&mv.minTag); tag < minTag {
+		tag = minTag
+	}
+	if tag > mv.maxTag {
+		mv.maxTag = tag
+	}
+	return strconv.FormatInt(tag, 16)
+}
+
+// newOtherRollupTag generates the tag of the series folding the metrics that dropped out of the top-K. Its label
+// values are the ones of the live "other" metric, that may have been created within the same second: the tag is greater
+// than all the tags generated so far, and it is retired right away so that the metrics created afterwards get a greater
+// tag. The tags of a TagGenerator are used as is, since they differ for each new life cycle of the same label values.
+func (mv *MetricVec[M]) newOtherRollupTag(labelValues []string) string {
+	if mv.opts.TagGenerator != nil {
+		return mv.opts.TagGenerator(mv.clock.Now(), labelValues)
+	}
+	mv.tagMutex.Lock()
+	defer mv.tagMutex.Unlock()
+	tag := mv.clock.Now().Unix()
+	if minTag := atomic.LoadInt64(&mv.minTag); tag < minTag {
+		tag = minTag
+	}
+	if tag <= mv.maxTag {
+		tag = mv.maxTag + 1
+	}
+	mv.maxTag = tag
+	formatted := strconv.FormatInt(tag, 16)
+	mv.retireLifeCycleTag(formatted)
+	return formatted
+}
+
+func (mv *MetricVec[M]) retireLifeCycleTag(tag string) {
+	value, err := strconv.ParseInt(tag, 16, 64)
+	if err != nil {
+		return
+	}
+	for {
+		minTag := atomic.LoadInt64(&mv.minTag)
+		if value < minTag || atomic.CompareAndSwapInt64(&mv.minTag, minTag, value+1) {
+			return
+		}
+	}
+}
+
+// rollupMetric adds the value of a removed metric to its rollup series, if any.
+// The metrics that dropped out of the top-K are folded into the "other" series.
+func (mv *MetricVec[M]) rollupMetric(metric prometheus.Metric, labelValues []string, reason removalReason) {
+	rollups, newTag := mv.rollups, mv.newLifeCycleTag
+	if reason == removalDroppedOut {
+		rollups, newTag = mv.topKRollups, mv.newOtherRollupTag
+	}
+	if rollups != nil {
+		rollups.add(metric, labelValues, newTag)
+	}
+}
+
+// updateTopK recomputes the top-K when its period is over, removing the metrics that dropped out of it.
+func (mv *MetricVec[M]) updateTopK(now time.Time) {
+	for _, labelValues := range mv.topK.update(now) {
+		mv.deleteLabelValues(labelValues, removalDroppedOut)
+	}
+}
+
 // GetMetricWithLabelValues returns the Metric for the given slice of label
 // values (same order as the variable labels in Desc). If that combination of
 // label values is accessed for the first time, a new Metric is created.
@@ -208,24 +587,32 @@ func (mv *MetricVec[M]) deleteMetricByInstance(metric prometheus.Metric) bool {
 // the reason explained above. Since the expiration time will never be reset, the metrics would automatically
 // expires after ExpirationDelay, even if its value is updated.
 //
+// If the vector is full (see MaxSeries) and its LimitPolicy is LimitReject, ErrSeriesLimitReached is returned
+// when a new metric would be created.
+//
+// In top-K mode (see TopK), the "other" metric is returned when the label values are not part of the top-K.
+//
+// When the label values are quarantined (see Quarantine), a detached metric that is never collected is returned.
+// When the vector is disabled (see SetEnabled), the same detached metric is returned whatever the label values.
+//
 // This function mimics the function of [prometheus.MetricVec] with the same name.
 func (mv *MetricVec[M]) GetMetricWithLabelValues(labelValues ...string) (M, error) {
-
-	// First try to get an existing metric with Read lock only
-	mv.mutex.RLock()
-	metric, err := mv.getMetric(labelValues...)
-	mv.mutex.RUnlock()
-
-	if metric == nil && err == nil {
-		// The metrics was not found, take a write lock to create a new one
-		mv.mutex.Lock()
-		metric, err = mv.getMetric(labelValues...) // a metric may still have been created between the two locks
-		if metric == nil && err == nil {
-			metric, err = mv.addMetric(labelValues...)
+	if atomic.LoadInt32(&mv.disabled) != 0 {
+		m, _ := mv.discard.(M)
+		return m, nil
+	}
+	if mv.topK != nil && len(labelValues) == len(mv.labelNames) {
+		// the period is advanced on access as well, so that it does not depend on the collections
+		if now := mv.clock.Now(); mv.topK.due(now) {
+			mv.updateTopK(now)
+		}
+		if !mv.topK.hit(labelValues) {
+			labelValues = mv.topK.otherValues
 		}
-		mv.mutex.Unlock()
 	}
-	return metric.(M), err
+	metric, err := mv.getOrAddMetric(labelValues, true)
+	m, _ := metric.(M)
+	return m, err
 }
 
 // WithLabelValues works as GetMetricWithLabelValues, but panics where
@@ -270,10 +657,18 @@ func (mv *MetricVec[M]) With(labels prometheus.Labels) M {
 
 // DeleteLabelValues removes the metrics associated to the given slice of label
 // values (same order as the variable labels in Desc). It returns true if a metric was deleted.
+// The accesses counted for label values pending admission are forgotten as well.
 func (mv *MetricVec[M]) DeleteLabelValues(labelValues ...string) bool {
-	mv.mutex.Lock()
-	defer mv.mutex.Unlock()
-	return mv.deleteMetric(labelValues...)
+	return mv.deleteLabelValues(labelValues, removalDeleted)
+}
+
+func (mv *MetricVec[M]) deleteLabelValues(labelValues []string, reason removalReason) bool {
+	hash := hashStringSlice(labelValues)
+	shard := mv.shard(hash)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	delete(shard.candidates, hash)
+	return mv.deleteMetric(shard, hash, labelValues, reason)
 }
 
 // DeleteLabelValues removes the metrics associated to the given label map
@@ -286,13 +681,82 @@ func (mv *MetricVec[M]) Delete(labels prometheus.Labels) bool {
 	return mv.DeleteLabelValues(labelValues...)
 }
 
-// Reset delete all the metrics of this vector.
+// Reset delete all the metrics of this vector, including the rollup series.
+// The metrics created afterwards start new life cycles.
 func (mv *MetricVec[M]) Reset() {
-	mv.mutex.Lock()
-	defer mv.mutex.Unlock()
-	mv.metricAttrs = make(map[prometheus.Metric]*metricAttr)
+	for i := range mv.shards {
+		mv.shards[i].mutex.Lock()
+	}
+	count := 0
+	for i := range mv.shards {
+		count += len(mv.shards[i].metricAttrs)
+		for _, attr := range mv.shards[i].metricAttrs {
+			mv.retireLifeCycleTag(attr.tag)
+			if mv.opts.Interner != nil {
+				mv.opts.Interner.release(attr.taggedValues)
+			}
+		}
+		mv.shards[i].init()
+	}
 	mv.metricVec.Reset()
-	mv.tags = newTagMap()
+	if mv.rollups != nil {
+		mv.rollups.reset()
+	}
+	if mv.topKRollups != nil {
+		mv.topKRollups.reset()
+	}
+	for i := range mv.shards {
+		mv.shards[i].mutex.Unlock()
+	}
+	mv.release(count)
+
+	mv.cleanUpMutex.Lock()
+	defer mv.cleanUpMutex.Unlock()
+	if mv.stopCleanUp != nil {
+		mv.stopCleanUp()
+		mv.stopCleanUp = nil
+	}
+}
+
+// scheduleCleanUp schedules the removal of the expired metrics, so that they are removed even if the vector
+// is not collected. It is only scheduled when the metrics of the vector can expire.
+func (mv *MetricVec[M]) scheduleCleanUp() {
+	mv.cleanUpMutex.Lock()
+	defer mv.cleanUpMutex.Unlock()
+	if mv.stopCleanUp != nil {
+		return
+	}
+	interval := mv.tunables.getExpirationDelay()
+	if ttl := mv.minLabelTTL(); ttl > 0 && (interval <= 0 || ttl < interval) {
+		interval = ttl
+	}
+	if window := mv.opts.AdmissionWindow; mv.opts.AdmissionThreshold > 1 && window > 0 && (interval <= 0 || window < interval) {
+		interval = window
+	}
+	if interval > 0 {
+		mv.stopCleanUp = mv.clock.AfterFunc(interval, mv.cleanUp)
+	}
+}
+
+// cleanUp removes the expired metrics and the label values whose admission window is over.
+func (mv *MetricVec[M]) cleanUp() {
+	mv.cleanUpMutex.Lock()
+	mv.stopCleanUp = nil
+	mv.cleanUpMutex.Unlock()
+
+	now := mv.clock.Now()
+	remaining := 0
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.Lock()
+		mv.expire(shard, now)
+		shard.expireCandidates(now)
+		remaining += len(shard.metricAttrs) + len(shard.candidates)
+		shard.mutex.Unlock()
+	}
+	if remaining > 0 {
+		mv.scheduleCleanUp()
+	}
 }
 
 // Describe implements [prometheus.Collector].
@@ -304,32 +768,81 @@ func (mv *MetricVec[M]) Describe(ch chan<- *prometheus.Desc) {
 //
 // Recently added metrics are collected with their initial value till the end of their WarmUp duration.
 //
-// Expired metrics are ignored and removed from this vector.
+// In top-K mode, the members of the top-K are recomputed when due and the metrics that dropped out are removed.
+//
+// Expired metrics are ignored and removed from this vector. When a rollup is configured, their
+// final value is added to the rollup series that are collected along with the other metrics.
+//
+// Nothing is collected while the vector is disabled (see SetEnabled).
+//
+// The metrics are sent on the channel without holding the lock of the vector: a slow collection does not block
+// the creation of new metrics. The state of the metrics (warm-up, expiration) is updated exactly once per
+// collection, while taking the snapshot of the metrics to send.
 func (mv *MetricVec[M]) Collect(ch chan<- prometheus.Metric) {
+	if atomic.LoadInt32(&mv.disabled) != 0 {
+		return
+	}
+	start := time.Now()
+	for _, metric := range mv.collectSnapshot() {
+		ch <- metric
+	}
+	mv.counters.onCollect(time.Since(start))
+}
 
-	expiredMetrics := make([]prometheus.Metric, 16)
-
-	mv.mutex.RLock()
-	defer mv.mutex.RUnlock()
-	for metric, attr := range mv.metricAttrs {
-		state := attr.onCollect(mv.opts.WarmUpDuration)
-		if state == stateExpired {
-			expiredMetrics = append(expiredMetrics, metric)
-		} else if state == stateWarmUpOngoing {
-			ch <- mv.opts.InitialMetric(metric, append(attr.labelValues, attr.tag))
-		} else {
-			ch <- metric
-		}
+// collectSnapshot returns the metrics to send for a collection, updating their state.
+func (mv *MetricVec[M]) collectSnapshot() []prometheus.Metric {
+	now := mv.clock.Now()
+
+	// Remove the metrics that dropped out of the top-K
+	if mv.topK != nil {
+		mv.updateTopK(now)
 	}
 
-	// Clean-up the expired metrics asynchronously
-	if len(expiredMetrics) >= 0 {
-		go func() {
-			mv.mutex.Lock()
-			defer mv.mutex.Unlock()
-			for _, metric := range expiredMetrics {
-				mv.deleteMetricByInstance(metric)
+	snapshot := make([]prometheus.Metric, 0, atomic.LoadInt64(&mv.seriesCount))
+	var completed []*metricAttr
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+
+		// Remove the expired metrics first, only the metrics due for expiration are visited
+		shard.mutex.RLock()
+		due := shard.expiries.due(now)
+		shard.mutex.RUnlock()
+		if due {
+			shard.mutex.Lock()
+			mv.expire(shard, now)
+			shard.mutex.Unlock()
+		}
+
+		shard.mutex.RLock()
+		for metric, attr := range shard.metricAttrs {
+			state, warmUpCompleted := attr.onCollect(now, mv.tunables.getWarmUpDuration())
+			if warmUpCompleted {
+				completed = append(completed, attr)
 			}
-		}()
+			if state == stateWarmUpOngoing {
+				snapshot = append(snapshot, mv.opts.InitialMetric(metric, attr.taggedValues))
+			} else {
+				snapshot = append(snapshot, metric)
+			}
+		}
+		shard.mutex.RUnlock()
+
+		// The metrics that completed their warm-up can expire from now on
+		if len(completed) > 0 {
+			shard.mutex.Lock()
+			for _, attr := range completed {
+				mv.queueExpiry(shard, attr)
+			}
+			shard.mutex.Unlock()
+			completed = completed[:0]
+		}
+	}
+
+	if mv.rollups != nil {
+		snapshot = mv.rollups.appendMetrics(snapshot)
+	}
+	if mv.topKRollups != nil {
+		snapshot = mv.topKRollups.appendMetrics(snapshot)
 	}
+	return snapshot
 }
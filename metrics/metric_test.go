@@ -0,0 +1,323 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricVec_CollectDoesNotBlockWrites(t *testing.T) {
+	t.Parallel()
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+
+	// A gatherer that does not read the channel
+	ch := make(chan prometheus.Metric)
+	go counter.Collect(ch)
+	<-ch
+
+	// New metrics can be created while the collection is stuck
+	done := make(chan struct{})
+	go func() {
+		counter.WithLabelValues("tata").Inc()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "metric creation blocked by the collection")
+	}
+	<-ch
+}
+
+// BenchmarkMetricVec_CreateDuringCollect measures the latency of the creation of new metrics
+// while a large vector is continuously collected by a slow gatherer.
+func BenchmarkMetricVec_CreateDuringCollect(b *testing.B) {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	for i := 0; i < 100000; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			ch := make(chan prometheus.Metric)
+			go func() {
+				counter.Collect(ch)
+				close(ch)
+			}()
+			for metric := range ch {
+				var m dto.Metric
+				_ = metric.Write(&m)
+			}
+		}
+	}()
+
+	var maxLatency time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		counter.WithLabelValues("new-" + strconv.Itoa(i)).Inc()
+		if latency := time.Since(start); latency > maxLatency {
+			maxLatency = latency
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(maxLatency.Nanoseconds()), "max-ns/op")
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestMetricVec_ConcurrentCreationRespectsMaxSeries(t *testing.T) {
+	t.Parallel()
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+		VectorOpts: VectorOpts{
+			MaxSeries:   50,
+			LimitPolicy: LimitEvictLeastActive,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				counter.WithLabelValues(strconv.Itoa(g*1000 + i%100)).Inc()
+				counter.DeleteLabelValues(strconv.Itoa(g*1000 + i%7))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, counter.countMetrics(), 50)
+	assert.Equal(t, int64(counter.countMetrics()), counter.seriesCount)
+	assert.Equal(t, counter.countMetrics(), counter.countTags())
+}
+
+// BenchmarkMetricVec_ParallelCreate measures the creation of new metrics from concurrent goroutines.
+func BenchmarkMetricVec_ParallelCreate(b *testing.B) {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.WithLabelValues(strconv.FormatInt(atomic.AddInt64(&next, 1), 10)).Inc()
+		}
+	})
+}
+
+// countMetrics returns the number of exported metrics of the vector.
+func (mv *MetricVec[M]) countMetrics() int {
+	count := 0
+	for i := range mv.shards {
+		mv.shards[i].mutex.RLock()
+		count += len(mv.shards[i].metricAttrs)
+		mv.shards[i].mutex.RUnlock()
+	}
+	return count
+}
+
+// countPending returns the number of label values pending admission of the vector.
+func (mv *MetricVec[M]) countPending() int {
+	count := 0
+	for i := range mv.shards {
+		mv.shards[i].mutex.RLock()
+		count += len(mv.shards[i].candidates)
+		mv.shards[i].mutex.RUnlock()
+	}
+	return count
+}
+
+// countTags returns the number of label values having a life cycle tag in the vector.
+func (mv *MetricVec[M]) countTags() int {
+	count := 0
+	for i := range mv.shards {
+		mv.shards[i].mutex.RLock()
+		for _, elems := range mv.shards[i].tags.index {
+			count += len(elems)
+		}
+		mv.shards[i].mutex.RUnlock()
+	}
+	return count
+}
+
+func (mv *MetricVec[M]) hasTag(labelValues ...string) bool {
+	shard := mv.shard(hashStringSlice(labelValues))
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	_, present := shard.tags.Get(labelValues)
+	return present
+}
+
+func TestMetricVec_LookupDoesNotAllocate(t *testing.T) {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock:           metricstest.NewFakeClock(defaultTime),
+		ExpirationDelay: time.Hour,
+	}
+	counter := NewCounterVec(opts, []string{"method", "code"})
+	counter.WithLabelValues("GET", "200").Inc()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		counter.WithLabelValues("GET", "200").Inc()
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestMetricVec_DoesNotKeepCallerLabelValues(t *testing.T) {
+	t.Parallel()
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	labelValues := make([]string, 1, 2)
+	labelValues[0] = "toto"
+	counter.WithLabelValues(labelValues...).Inc()
+	assert.Equal(t, []string{"toto", ""}, labelValues[:2])
+
+	labelValues[0] = "titi"
+	assert.True(t, counter.hasTag("toto"))
+	assert.False(t, counter.hasTag("titi"))
+}
+
+func BenchmarkMetricVec_WithLabelValuesExisting(b *testing.B) {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		ExpirationDelay: time.Hour,
+	}
+	counter := NewCounterVec(opts, []string{"method", "code"})
+	counter.WithLabelValues("GET", "200").Inc()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter.WithLabelValues("GET", "200").Inc()
+	}
+}
+
+// BenchmarkPrometheusCounterVec_WithLabelValuesExisting is the reference for BenchmarkMetricVec_WithLabelValuesExisting.
+func BenchmarkPrometheusCounterVec_WithLabelValuesExisting(b *testing.B) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "count",
+		Help: "Help message",
+	}, []string{"method", "code"})
+	counter.WithLabelValues("GET", "200").Inc()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter.WithLabelValues("GET", "200").Inc()
+	}
+}
+
+func BenchmarkMetricVec_WithLabelValuesExistingParallel(b *testing.B) {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		ExpirationDelay: time.Hour,
+	}
+	counter := NewCounterVec(opts, []string{"method", "code"})
+	counter.WithLabelValues("GET", "200").Inc()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.WithLabelValues("GET", "200").Inc()
+		}
+	})
+}
+
+// BenchmarkPrometheusCounterVec_WithLabelValuesExistingParallel is the reference for
+// BenchmarkMetricVec_WithLabelValuesExistingParallel.
+func BenchmarkPrometheusCounterVec_WithLabelValuesExistingParallel(b *testing.B) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "count",
+		Help: "Help message",
+	}, []string{"method", "code"})
+	counter.WithLabelValues("GET", "200").Inc()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.WithLabelValues("GET", "200").Inc()
+		}
+	})
+}
+
+func TestMetricVec_TagGenerator(t *testing.T) {
+	generation := 0
+	vec := NewGaugeVec(GaugeOpts{
+		GaugeOpts: prometheus.GaugeOpts{Name: "sessions", Help: "Help message"},
+		VectorOpts: VectorOpts{TagGenerator: func(now time.Time, labelValues []string) string {
+			generation++
+			return fmt.Sprintf("%s-%d", labelValues[0], generation)
+		}},
+	}, []string{"tenant"})
+
+	vec.WithLabelValues("acme").Inc()
+	vec.DeleteLabelValues("acme")
+	vec.WithLabelValues("acme").Inc()
+
+	expect := `
+		# HELP sessions Help message
+		# TYPE sessions gauge
+		sessions{_tag_="acme-2",tenant="acme"} 1
+		`
+	assert.NoError(t, testutil.CollectAndCompare(vec, strings.NewReader(expect)))
+}
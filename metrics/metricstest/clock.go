@@ -0,0 +1,105 @@
+// Package metricstest provides utilities for testing code instrumented with the metrics of this library.
+package metricstest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type fakeTimer struct {
+	deadline time.Time
+	f        func()
+}
+
+// FakeClock is an implementation of metrics.Clock whose time only changes when calling Set or Advance.
+//
+// The functions scheduled with AfterFunc (e.g. the clean-up of expired metrics) are called synchronously by
+// Set and Advance, by order of their due time, when their time has come. While such function runs, Now returns
+// its due time. This makes the expiration of metrics deterministic in tests.
+//
+// A FakeClock is safe for concurrent use, and each vector of metrics can be given its own FakeClock.
+type FakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock creates a new FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules the call of f once the clock has advanced by d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := &fakeTimer{deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.removeTimer(timer)
+	}
+}
+
+// Advance advances the time of the clock by d, calling the scheduled functions that are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set sets the time of the clock, calling the scheduled functions that are due.
+// Setting a time before the current one does not trigger any function.
+func (c *FakeClock) Set(now time.Time) {
+	for {
+		c.mutex.Lock()
+		timer := c.nextTimer(now)
+		if timer == nil {
+			c.now = now
+			c.mutex.Unlock()
+			return
+		}
+		c.removeTimer(timer)
+		if timer.deadline.After(c.now) {
+			c.now = timer.deadline
+		}
+		c.mutex.Unlock()
+		timer.f()
+	}
+}
+
+// PendingCalls returns the number of scheduled functions that have not been called yet.
+func (c *FakeClock) PendingCalls() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.timers)
+}
+
+// must be called holding c.mutex
+func (c *FakeClock) nextTimer(now time.Time) *fakeTimer {
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+	if len(c.timers) == 0 || c.timers[0].deadline.After(now) {
+		return nil
+	}
+	return c.timers[0]
+}
+
+// must be called holding c.mutex
+func (c *FakeClock) removeTimer(timer *fakeTimer) bool {
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
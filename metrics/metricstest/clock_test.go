@@ -0,0 +1,46 @@
+package metricstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock_Advance(t *testing.T) {
+	t0 := time.Unix(1219204980, 0)
+	clock := NewFakeClock(t0)
+	assert.Equal(t, t0, clock.Now())
+
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, t0.Add(5*time.Second), clock.Now())
+
+	clock.Set(t0)
+	assert.Equal(t, t0, clock.Now())
+}
+
+func TestFakeClock_AfterFunc(t *testing.T) {
+	t0 := time.Unix(1219204980, 0)
+	clock := NewFakeClock(t0)
+
+	var calls []time.Time
+	record := func() { calls = append(calls, clock.Now()) }
+	clock.AfterFunc(10*time.Second, record)
+	clock.AfterFunc(5*time.Second, func() {
+		record()
+		// functions scheduled while advancing are called if they are due
+		clock.AfterFunc(2*time.Second, record)
+	})
+	stop := clock.AfterFunc(7*time.Second, record)
+	assert.True(t, stop())
+	assert.False(t, stop())
+	assert.Equal(t, 2, clock.PendingCalls())
+
+	clock.Advance(4 * time.Second)
+	assert.Empty(t, calls)
+
+	clock.Advance(6 * time.Second)
+	assert.Equal(t, []time.Time{t0.Add(5 * time.Second), t0.Add(7 * time.Second), t0.Add(10 * time.Second)}, calls)
+	assert.Equal(t, t0.Add(10*time.Second), clock.Now())
+	assert.Equal(t, 0, clock.PendingCalls())
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelMatch matches the metrics of a vector having some label values, indexed by the position of their label.
+type labelMatch map[int]string
+
+// newLabelMatch returns the labelMatch of the given labels, or false if a label is not a label of the vector.
+func newLabelMatch(labelNames []string, labels prometheus.Labels) (labelMatch, bool) {
+	match := make(labelMatch, len(labels))
+	for name, value := range labels {
+		i := indexOf(labelNames, name)
+		if i < 0 {
+			return nil, false
+		}
+		match[i] = value
+	}
+	return match, true
+}
+
+func (m labelMatch) matches(labelValues []string) bool {
+	for i, value := range m {
+		if i >= len(labelValues) || labelValues[i] != value {
+			return false
+		}
+	}
+	return true
+}
+
+type quarantine struct {
+	match labelMatch
+	// end of the quarantine, in unix nanoseconds
+	until int64
+}
+
+// quarantineList holds the quarantines of a vector, see MetricVec.Quarantine.
+type quarantineList struct {
+	mutex   sync.RWMutex
+	entries []quarantine
+}
+
+func (l *quarantineList) add(q quarantine) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = append(l.entries, q)
+}
+
+// contains returns true when the label values are quarantined, removing the quarantines that are over.
+func (l *quarantineList) contains(labelValues []string, now time.Time) bool {
+	l.mutex.RLock()
+	found, over := false, false
+	for _, q := range l.entries {
+		if now.UnixNano() >= q.until {
+			over = true
+		} else if q.match.matches(labelValues) {
+			found = true
+		}
+	}
+	l.mutex.RUnlock()
+	if over {
+		l.prune(now)
+	}
+	return found
+}
+
+func (l *quarantineList) prune(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entries := l.entries[:0]
+	for _, q := range l.entries {
+		if now.UnixNano() < q.until {
+			entries = append(entries, q)
+		}
+	}
+	for i := len(entries); i < len(l.entries); i++ {
+		l.entries[i] = quarantine{}
+	}
+	l.entries = entries
+}
+
+func (l *quarantineList) empty() bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return len(l.entries) == 0
+}
+
+// DeletePartialMatch deletes all the metrics whose label values match the given labels, and returns the number of
+// deleted metrics. The given labels can be a subset of the labels of the vector; no metric is deleted when they
+// include a label that is not a label of the vector. The rollup series matching the labels are deleted as well.
+//
+// This function mimics the function of [prometheus.MetricVec] with the same name.
+func (mv *MetricVec[M]) DeletePartialMatch(labels prometheus.Labels) int {
+	return len(mv.DeletePartialMatchLabelValues(labels))
+}
+
+// DeletePartialMatchLabelValues works as DeletePartialMatch, but returns the label values of the deleted metrics.
+func (mv *MetricVec[M]) DeletePartialMatchLabelValues(labels prometheus.Labels) [][]string {
+	match, ok := newLabelMatch(mv.labelNames, labels)
+	if !ok {
+		return nil
+	}
+	var deleted [][]string
+	var matching []prometheus.Metric
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.Lock()
+		for metric, attr := range shard.metricAttrs {
+			if match.matches(attr.labelValues) {
+				matching = append(matching, metric)
+				deleted = append(deleted, append([]string(nil), attr.labelValues...))
+			}
+		}
+		for _, metric := range matching {
+			mv.deleteMetricByInstance(shard, metric, removalDeleted)
+		}
+		shard.mutex.Unlock()
+		matching = matching[:0]
+	}
+	if mv.rollups != nil {
+		// the removed metrics may have been rolled up to series still having the label values
+		mv.rollups.deleteMatching(match)
+	}
+	if mv.topKRollups != nil {
+		mv.topKRollups.deleteMatching(match)
+	}
+	return deleted
+}
+
+// Quarantine prevents the creation of the metrics whose label values match the given labels for the given duration,
+// e.g. to make sure that deleted label values are not exported again. The given labels can be a subset of the labels
+// of the vector. It returns false when they include a label that is not a label of the vector.
+//
+// While quarantined, the label values get a detached metric: it can be updated but it is never collected.
+// The existing metrics are not affected, see DeletePartialMatch.
+func (mv *MetricVec[M]) Quarantine(labels prometheus.Labels, d time.Duration) bool {
+	match, ok := newLabelMatch(mv.labelNames, labels)
+	if !ok {
+		return false
+	}
+	mv.quarantines.add(quarantine{match: match, until: mv.clock.Now().Add(d).UnixNano()})
+	return true
+}
+
+// quarantined returns true when the label values are quarantined.
+func (mv *MetricVec[M]) quarantined(labelValues []string) bool {
+	return !mv.quarantines.empty() && mv.quarantines.contains(labelValues, mv.clock.Now())
+}
+
+// detachedMetric returns a new metric of the given label values that is not part of the vector.
+func (mv *MetricVec[M]) detachedMetric(labelValues []string) (prometheus.Metric, error) {
+	taggedValues := make([]string, len(labelValues)+1)
+	copy(taggedValues, labelValues)
+	metric, err := mv.metricVec.GetMetricWithLabelValues(taggedValues...)
+	if err != nil {
+		return nil, err
+	}
+	mv.metricVec.DeleteLabelValues(taggedValues...)
+	return metric, nil
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_DeletePartialMatch(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		RollupLabels: prometheus.Labels{"operation": "__removed__"},
+		Clock:        clock,
+	}
+	counter := NewCounterVec(opts, []string{"tenant", "operation"})
+	counter.WithLabelValues("t1", "read").Add(10)
+	counter.WithLabelValues("t1", "write").Add(5)
+	counter.WithLabelValues("t2", "read").Add(3)
+	counter.DeleteLabelValues("t2", "read")
+
+	assert.Equal(t, 0, counter.DeletePartialMatch(prometheus.Labels{"tenant": "t1", "unknown": "x"}))
+	assert.ElementsMatch(t, [][]string{{"t1", "read"}, {"t1", "write"}},
+		counter.DeletePartialMatchLabelValues(prometheus.Labels{"tenant": "t1"}))
+	assert.Equal(t, int64(0), counter.seriesCount)
+
+	// the rollup series of the deleted tenant are removed as well
+	expect := `
+		# HELP namespace_count Help message
+		# TYPE namespace_count counter
+		namespace_count{_tag_="48ab9774",operation="__removed__",tenant="t2"} 3
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_count")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_Quarantine(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := newExpiringCounterVec(clock)
+	assert.False(t, counter.Quarantine(prometheus.Labels{"unknown": "x"}, time.Hour))
+	assert.True(t, counter.Quarantine(prometheus.Labels{"label": "toto"}, time.Hour))
+
+	// the quarantined label values get a detached metric
+	counter.WithLabelValues("toto").Add(2)
+	counter.WithLabelValues("titi").Inc()
+	assert.Equal(t, 1, counter.countMetrics())
+	assert.False(t, counter.hasTag("toto"))
+	assert.Equal(t, 1, testutil.CollectAndCount(counter))
+
+	// the label values can be used again at the end of the quarantine
+	clock.Advance(time.Hour)
+	counter.WithLabelValues("toto").Inc()
+	assert.True(t, counter.hasTag("toto"))
+	assert.True(t, counter.quarantines.empty())
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+// WarmUpSetter is implemented by the metrics whose warm-up duration can be changed at runtime: the counters,
+// histograms and summaries created by this package, and all the vectors of metrics.
+type WarmUpSetter interface {
+	SetWarmUpDuration(d time.Duration)
+}
+
+// tunables holds the options of a vector that can be changed at runtime, accessed atomically.
+type tunables struct {
+	warmUpDuration  int64
+	expirationDelay int64
+	maxSeries       int64
+	limitPolicy     int64
+}
+
+func newTunables(opts metricOpts) tunables {
+	return tunables{
+		warmUpDuration:  int64(opts.WarmUpDuration),
+		expirationDelay: int64(opts.ExpirationDelay),
+		maxSeries:       int64(opts.MaxSeries),
+		limitPolicy:     int64(opts.LimitPolicy),
+	}
+}
+
+func (t *tunables) getWarmUpDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.warmUpDuration))
+}
+
+func (t *tunables) getExpirationDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.expirationDelay))
+}
+
+func (t *tunables) getMaxSeries() int {
+	return int(atomic.LoadInt64(&t.maxSeries))
+}
+
+func (t *tunables) getLimitPolicy() LimitPolicy {
+	return LimitPolicy(atomic.LoadInt64(&t.limitPolicy))
+}
+
+// SetWarmUpDuration changes the warm-up duration of the metric. It applies to the ongoing warm-up as well.
+func (c *singleCollector) SetWarmUpDuration(d time.Duration) {
+	atomic.StoreInt64(&c.warmUpDuration, int64(d))
+}
+
+// SetWarmUpDuration changes the warm-up duration of the metrics of the vector. The warm-up of the metrics whose
+// warm-up is ongoing ends at the start of their warm-up plus the new duration.
+func (mv *MetricVec[M]) SetWarmUpDuration(d time.Duration) {
+	atomic.StoreInt64(&mv.tunables.warmUpDuration, int64(d))
+}
+
+// SetExpirationDelay changes the expiration delay of the metrics of the vector (zero value means infinite expiration
+// time). The deadlines of the existing metrics are computed again from their last access and the new delay: the
+// metrics not accessed for longer than the new delay are removed on the next collection or clean-up.
+func (mv *MetricVec[M]) SetExpirationDelay(d time.Duration) {
+	atomic.StoreInt64(&mv.tunables.expirationDelay, int64(d))
+	remaining := 0
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.Lock()
+		mv.requeueExpiries(shard)
+		remaining += len(shard.metricAttrs) + len(shard.candidates)
+		shard.mutex.Unlock()
+	}
+
+	// the clean-up may have been scheduled with the previous delay
+	mv.cleanUpMutex.Lock()
+	if mv.stopCleanUp != nil {
+		mv.stopCleanUp()
+		mv.stopCleanUp = nil
+	}
+	mv.cleanUpMutex.Unlock()
+	if remaining > 0 {
+		mv.scheduleCleanUp()
+	}
+}
+
+// must be called holding shard.mutex.Lock
+//
+// requeueExpiries rebuilds the expiry queue of the shard with the current deadlines of its metrics.
+func (mv *MetricVec[M]) requeueExpiries(shard *metricShard) {
+	for i := range shard.expiries {
+		shard.expiries[i].attr.queued = false
+		shard.expiries[i] = expiryEntry{}
+	}
+	shard.expiries = shard.expiries[:0]
+	for _, attr := range shard.metricAttrs {
+		if deadline, ok := mv.deadline(attr); ok {
+			attr.queued = true
+			attr.queueIndex = len(shard.expiries)
+			shard.expiries = append(shard.expiries, expiryEntry{deadline: deadline, attr: attr})
+		}
+	}
+	heap.Init(&shard.expiries)
+}
+
+// SetMaxSeries changes the maximum number of metrics exported by the vector (zero value means no limit).
+// When the vector holds more metrics than the new maximum, the least active metrics are evicted if the limit policy is
+// LimitEvictLeastActive. Otherwise, the existing metrics are kept and no new metric is added until enough metrics
+// are removed.
+func (mv *MetricVec[M]) SetMaxSeries(maxSeries int) {
+	atomic.StoreInt64(&mv.tunables.maxSeries, int64(maxSeries))
+	if maxSeries <= 0 || mv.tunables.getLimitPolicy() != LimitEvictLeastActive {
+		return
+	}
+	for atomic.LoadInt64(&mv.seriesCount) > int64(maxSeries) && mv.evictLeastActive() {
+	}
+}
+
+// SetLimitPolicy changes the policy applied when the vector is full.
+func (mv *MetricVec[M]) SetLimitPolicy(policy LimitPolicy) {
+	atomic.StoreInt64(&mv.tunables.limitPolicy, int64(policy))
+}
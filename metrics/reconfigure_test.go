@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricVec_SetExpirationDelay(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := newExpiringCounterVec(clock)
+	counter.SetExpirationDelay(time.Hour)
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+	testutil.CollectAndCount(counter)
+	clock.Advance(time.Second)
+	testutil.CollectAndCount(counter)
+
+	// the shorter delay applies to the existing metrics
+	clock.Advance(2 * time.Minute)
+	counter.WithLabelValues("titi").Inc()
+	counter.SetExpirationDelay(time.Minute)
+	assert.Equal(t, 2, counter.countMetrics())
+	// the clean-up is scheduled with the new delay
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, counter.countMetrics())
+	assert.True(t, counter.hasTag("titi"))
+
+	// no expiration
+	counter.SetExpirationDelay(0)
+	assert.Equal(t, 0, counter.countQueued())
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, testutil.CollectAndCount(counter))
+
+	// the metrics expire again
+	counter.SetExpirationDelay(time.Minute)
+	assert.Equal(t, 1, counter.countQueued())
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+}
+
+func TestMetricVec_SetWarmUpDuration(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		WarmUpDuration: time.Minute,
+		Clock:          clock,
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Inc()
+	single := NewCounter(opts)
+	single.Inc()
+
+	collect := func() (float64, float64) {
+		return testutil.ToFloat64(counter), testutil.ToFloat64(single)
+	}
+	vecValue, singleValue := collect()
+	assert.Equal(t, 0.0, vecValue)
+	assert.Equal(t, 0.0, singleValue)
+
+	// the ongoing warm-up ends earlier
+	clock.Advance(20 * time.Second)
+	counter.SetWarmUpDuration(10 * time.Second)
+	single.(WarmUpSetter).SetWarmUpDuration(10 * time.Second)
+	vecValue, singleValue = collect()
+	assert.Equal(t, 1.0, vecValue)
+	assert.Equal(t, 1.0, singleValue)
+}
+
+func TestMetricVec_SetMaxSeries(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock: clock,
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	for i := 0; i < 5; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+		clock.Advance(time.Second)
+	}
+
+	// the vector keeps its metrics but rejects the new ones
+	counter.SetMaxSeries(3)
+	assert.Equal(t, 5, counter.countMetrics())
+	_, err := counter.GetMetricWithLabelValues("new")
+	assert.ErrorIs(t, err, ErrSeriesLimitReached)
+
+	// the least active metrics are evicted
+	counter.SetLimitPolicy(LimitEvictLeastActive)
+	counter.SetMaxSeries(3)
+	assert.Equal(t, 3, counter.countMetrics())
+	assert.False(t, counter.hasTag("0"))
+	assert.False(t, counter.hasTag("1"))
+
+	counter.SetMaxSeries(0)
+	for i := 5; i < 10; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+	}
+	assert.Equal(t, 8, counter.countMetrics())
+}
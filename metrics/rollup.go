@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// rollupAccumulator accumulates the final values of the metrics removed from a vector.
+type rollupAccumulator interface {
+	// add adds the current value of the given metric to the accumulated value.
+	add(metric prometheus.Metric)
+	// metric returns a constant metric holding the accumulated value.
+	metric(desc *prometheus.Desc, labelValues []string) prometheus.Metric
+}
+
+type counterRollup struct {
+	value float64
+}
+
+func newCounterRollup() rollupAccumulator {
+	return &counterRollup{}
+}
+
+func (r *counterRollup) add(metric prometheus.Metric) {
+	var m dto.Metric
+	if err := metric.Write(&m); err == nil && m.Counter != nil {
+		r.value += m.Counter.GetValue()
+	}
+}
+
+func (r *counterRollup) metric(desc *prometheus.Desc, labelValues []string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(desc, prometheus.CounterValue, r.value, labelValues...)
+}
+
+type histogramRollup struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func newHistogramRollup() rollupAccumulator {
+	return &histogramRollup{buckets: make(map[float64]uint64)}
+}
+
+func (r *histogramRollup) add(metric prometheus.Metric) {
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil || m.Histogram == nil {
+		return
+	}
+	r.count += m.Histogram.GetSampleCount()
+	r.sum += m.Histogram.GetSampleSum()
+	for _, bucket := range m.Histogram.GetBucket() {
+		r.buckets[bucket.GetUpperBound()] += bucket.GetCumulativeCount()
+	}
+}
+
+func (r *histogramRollup) metric(desc *prometheus.Desc, labelValues []string) prometheus.Metric {
+	return prometheus.MustNewConstHistogram(desc, r.count, r.sum, r.buckets, labelValues...)
+}
+
+type rollupSeries struct {
+	desc        *prometheus.Desc
+	labelValues []string
+	acc         rollupAccumulator
+}
+
+// rollupMap holds the rollup series of a vector, indexed by their label values.
+//
+// The label values of a rollup series are the ones of the removed metrics, except for the
+// rollup labels that are replaced by their configured value.
+type rollupMap struct {
+	values    map[int]string
+	newRollup func() rollupAccumulator
+	series    map[string]*rollupSeries
+	// the metrics of the different shards of a vector are rolled up concurrently
+	mutex sync.Mutex
+}
+
+func newRollupMap(labelNames []string, rollupLabels prometheus.Labels, newRollup func() rollupAccumulator) *rollupMap {
+	values := make(map[int]string, len(rollupLabels))
+	for name, value := range rollupLabels {
+		i := indexOf(labelNames, name)
+		if i < 0 {
+			panic(fmt.Errorf("rollup label %q is not a label of the vector %v", name, labelNames))
+		}
+		values[i] = value
+	}
+	return &rollupMap{
+		values:    values,
+		newRollup: newRollup,
+		series:    make(map[string]*rollupSeries),
+	}
+}
+
+// add adds the value of a removed metric to its rollup series, creating it if needed with the tag given by newTag.
+func (r *rollupMap) add(metric prometheus.Metric, labelValues []string, newTag func(labelValues []string) string) {
+	values := make([]string, len(labelValues), len(labelValues)+1)
+	copy(values, labelValues)
+	for i, value := range r.values {
+		values[i] = value
+	}
+	key := labelValuesKey(values)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	series := r.series[key]
+	if series == nil {
+		// The rollup series never expires, so its lifecycle tag is generated once at creation.
+		series = &rollupSeries{
+			desc:        metric.Desc(),
+			labelValues: append(values, newTag(values)),
+			acc:         r.newRollup(),
+		}
+		r.series[key] = series
+	}
+	series.acc.add(metric)
+}
+
+// appendMetrics appends constant metrics holding the current value of the rollup series to the given list.
+func (r *rollupMap) appendMetrics(metrics []prometheus.Metric) []prometheus.Metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, series := range r.series {
+		metrics = append(metrics, series.acc.metric(series.desc, series.labelValues))
+	}
+	return metrics
+}
+
+func (r *rollupMap) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.series = make(map[string]*rollupSeries)
+}
+
+// deleteMatching deletes the rollup series whose label values match.
+func (r *rollupMap) deleteMatching(match labelMatch) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, series := range r.series {
+		if match.matches(series.labelValues) {
+			delete(r.series, key)
+		}
+	}
+}
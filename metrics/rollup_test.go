@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_RollupOnExpiration(t *testing.T) {
+	t.Parallel()
+
+	t0 := defaultTime
+	clock := metricstest.NewFakeClock(t0)
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		ExpirationDelay: 10 * time.Second,
+		RollupLabels:    prometheus.Labels{"tenant": "__expired__"},
+		Clock:           clock,
+	}
+	counter := NewCounterVec(opts, []string{"tenant", "operation"})
+	counter.WithLabelValues("t1", "read").Add(10)
+	counter.WithLabelValues("t2", "read").Add(5)
+	counter.WithLabelValues("t3", "write").Add(3)
+
+	// Make sure the metrics warmedUp
+	testutil.CollectAndCount(counter)
+	clock.Set(t0.Add(1)) // clock tick
+	testutil.CollectAndCount(counter)
+
+	// t1 is updated, the others expire and are rolled up by operation
+	clock.Set(t0.Add(5 * time.Second))
+	counter.WithLabelValues("t1", "read").Inc()
+	clock.Set(t0.Add(11 * time.Second))
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",operation="read",tenant="t1"} 11
+		namespace_something_count{_tag_="48ab977f",operation="read",tenant="__expired__"} 5
+		namespace_something_count{_tag_="48ab977f",operation="write",tenant="__expired__"} 3
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	// t1 expires as well, the rollup series are never removed
+	clock.Set(t0.Add(20 * time.Minute))
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab977f",operation="read",tenant="__expired__"} 16
+		namespace_something_count{_tag_="48ab977f",operation="write",tenant="__expired__"} 3
+		`
+	err = testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	counter.Reset()
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+}
+
+func TestHistogramVec_RollupOnDelete(t *testing.T) {
+	t.Parallel()
+
+	t0 := defaultTime
+	clock := metricstest.NewFakeClock(t0)
+
+	opts := HistogramOpts{
+		HistogramOpts: prometheus.HistogramOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "hist",
+			Help:      "Help message",
+			Buckets:   []float64{1.0, 10.0},
+		},
+		RollupLabels: prometheus.Labels{"user": "__deleted__"},
+		Clock:        clock,
+	}
+	hist := NewHistogramVec(opts, []string{"user"})
+	hist.WithLabelValues("alex").Observe(0.5)
+	hist.WithLabelValues("alex").Observe(5)
+	hist.WithLabelValues("toto").Observe(20)
+
+	assert.True(t, hist.DeleteLabelValues("alex"))
+	assert.True(t, hist.Delete(prometheus.Labels{"user": "toto"}))
+
+	expect := `
+		# HELP namespace_something_hist Help message
+		# TYPE namespace_something_hist histogram
+		namespace_something_hist_bucket{_tag_="48ab9774",user="__deleted__",le="1"} 1
+		namespace_something_hist_bucket{_tag_="48ab9774",user="__deleted__",le="10"} 2
+		namespace_something_hist_bucket{_tag_="48ab9774",user="__deleted__",le="+Inf"} 3
+		namespace_something_hist_sum{_tag_="48ab9774",user="__deleted__"} 25.5
+		namespace_something_hist_count{_tag_="48ab9774",user="__deleted__"} 3
+		`
+	err := testutil.CollectAndCompare(hist, strings.NewReader(expect), "namespace_something_hist")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_RollupUnknownLabel(t *testing.T) {
+	t.Parallel()
+
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		RollupLabels: prometheus.Labels{"unknown": "__expired__"},
+	}
+	assert.Panics(t, func() { NewCounterVec(opts, []string{"tenant"}) })
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// removalReason is the reason why a metric is removed from a vector.
+type removalReason int
+
+const (
+	// the metric was not accessed within the expiration delay
+	removalExpired removalReason = iota
+	// the metric was deleted by the application
+	removalDeleted
+	// the metric was evicted by a series limit
+	removalEvicted
+	// the metric dropped out of the top-K, it is counted as evicted
+	removalDroppedOut
+)
+
+// vectorCounters holds the cumulative statistics of a vector, accessed atomically.
+type vectorCounters struct {
+	created      int64
+	expired      int64
+	deleted      int64
+	evicted      int64
+	collections  int64
+	collectNanos int64
+}
+
+func (c *vectorCounters) onRemoval(reason removalReason) {
+	switch reason {
+	case removalExpired:
+		atomic.AddInt64(&c.expired, 1)
+	case removalDeleted:
+		atomic.AddInt64(&c.deleted, 1)
+	case removalEvicted, removalDroppedOut:
+		atomic.AddInt64(&c.evicted, 1)
+	}
+}
+
+func (c *vectorCounters) onCollect(duration time.Duration) {
+	atomic.AddInt64(&c.collectNanos, int64(duration))
+	atomic.AddInt64(&c.collections, 1)
+}
+
+// vectorStats is a snapshot of the statistics of a vector.
+type vectorStats struct {
+	// ID of the vector, the value of the vector label
+	id string
+	// number of metrics by warm-up state
+	series [stateWarmUpComplete + 1]int
+	// number of label values pending admission
+	pending int
+	// number of metrics past their deadline, waiting for the next clean-up
+	backlog  int
+	counters vectorCounters
+}
+
+// statsMember is a vector of metrics reporting its statistics to a StatsCollector.
+type statsMember interface {
+	stats() vectorStats
+}
+
+func (mv *MetricVec[M]) stats() vectorStats {
+	stats := vectorStats{id: mv.id}
+	now := mv.clock.Now()
+	for i := range mv.shards {
+		shard := &mv.shards[i]
+		shard.mutex.RLock()
+		for _, attr := range shard.metricAttrs {
+			stats.series[atomic.LoadUint32(&attr.state)]++
+		}
+		stats.pending += len(shard.candidates)
+		stats.backlog += mv.countExpired(shard, now)
+		shard.mutex.RUnlock()
+	}
+	stats.counters = vectorCounters{
+		created:      atomic.LoadInt64(&mv.counters.created),
+		expired:      atomic.LoadInt64(&mv.counters.expired),
+		deleted:      atomic.LoadInt64(&mv.counters.deleted),
+		evicted:      atomic.LoadInt64(&mv.counters.evicted),
+		collections:  atomic.LoadInt64(&mv.counters.collections),
+		collectNanos: atomic.LoadInt64(&mv.counters.collectNanos),
+	}
+	return stats
+}
+
+var (
+	statsSeriesDesc = prometheus.NewDesc("smart_vector_series",
+		"Number of series held by the vector, by state.", []string{"vector", "state"}, nil)
+	statsCreatedDesc = prometheus.NewDesc("smart_vector_lifecycles_created_total",
+		"Number of life cycles started by the vector, i.e. metrics created.", []string{"vector"}, nil)
+	statsExpiredDesc = prometheus.NewDesc("smart_vector_expirations_total",
+		"Number of metrics removed from the vector because they expired.", []string{"vector"}, nil)
+	statsDeletedDesc = prometheus.NewDesc("smart_vector_deletions_total",
+		"Number of metrics deleted from the vector by the application.", []string{"vector"}, nil)
+	statsEvictedDesc = prometheus.NewDesc("smart_vector_evictions_total",
+		"Number of metrics evicted from the vector by a series limit or dropped out of its top-K.", []string{"vector"}, nil)
+	statsCollectDesc = prometheus.NewDesc("smart_vector_collect_duration_seconds",
+		"Duration of the collections of the vector.", []string{"vector"}, nil)
+	statsBacklogDesc = prometheus.NewDesc("smart_vector_cleanup_backlog",
+		"Number of metrics of the vector past their deadline, waiting for the next clean-up.", []string{"vector"}, nil)
+)
+
+// stateNames are the values of the state label of smart_vector_series, by metricState.
+var stateNames = [...]string{
+	stateWarmUpPending:  SeriesWarmUpPending,
+	stateWarmUpOngoing:  SeriesWarmUpOngoing,
+	stateWarmUpComplete: SeriesWarmUpComplete,
+}
+
+// StatsCollector is a [prometheus.Collector] reporting the statistics of the vectors of metrics sharing it
+// (see VectorOpts), labelled by the ID of the vector (its fully-qualified name, followed by its constant labels if any,
+// see MetricVec.ID):
+//   - smart_vector_series: number of series by state (warm_up_pending, warm_up_ongoing, warm_up_complete and
+//     pending_admission)
+//   - smart_vector_lifecycles_created_total: number of metrics created
+//   - smart_vector_expirations_total, smart_vector_deletions_total and smart_vector_evictions_total: number of metrics
+//     removed, by reason
+//   - smart_vector_collect_duration_seconds: summary of the duration of the collections
+//   - smart_vector_cleanup_backlog: number of metrics past their deadline, waiting for the next clean-up
+//
+// The statistics of a vector are computed on collection and cost as much as a collection of the vector.
+// The vectors sharing a StatsCollector must have distinct IDs, like the vectors sharing a registry.
+type StatsCollector struct {
+	mutex   sync.Mutex
+	members []statsMember
+}
+
+// NewStatsCollector creates a new StatsCollector reporting the statistics of no vector till vectors are created with it.
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{}
+}
+
+func (s *StatsCollector) register(member statsMember) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.members = append(s.members, member)
+}
+
+func (s *StatsCollector) unregister(member statsMember) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, m := range s.members {
+		if m == member {
+			s.members = append(s.members[:i], s.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// Describe implements [prometheus.Collector].
+func (s *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- statsSeriesDesc
+	ch <- statsCreatedDesc
+	ch <- statsExpiredDesc
+	ch <- statsDeletedDesc
+	ch <- statsEvictedDesc
+	ch <- statsCollectDesc
+	ch <- statsBacklogDesc
+}
+
+// Collect implements [prometheus.Collector].
+func (s *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.Lock()
+	members := append([]statsMember(nil), s.members...)
+	s.mutex.Unlock()
+
+	for _, member := range members {
+		stats := member.stats()
+		for state, count := range stats.series {
+			ch <- prometheus.MustNewConstMetric(statsSeriesDesc, prometheus.GaugeValue, float64(count), stats.id, stateNames[state])
+		}
+		ch <- prometheus.MustNewConstMetric(statsSeriesDesc, prometheus.GaugeValue, float64(stats.pending), stats.id, SeriesPendingAdmission)
+		ch <- prometheus.MustNewConstMetric(statsCreatedDesc, prometheus.CounterValue, float64(stats.counters.created), stats.id)
+		ch <- prometheus.MustNewConstMetric(statsExpiredDesc, prometheus.CounterValue, float64(stats.counters.expired), stats.id)
+		ch <- prometheus.MustNewConstMetric(statsDeletedDesc, prometheus.CounterValue, float64(stats.counters.deleted), stats.id)
+		ch <- prometheus.MustNewConstMetric(statsEvictedDesc, prometheus.CounterValue, float64(stats.counters.evicted), stats.id)
+		ch <- prometheus.MustNewConstSummary(statsCollectDesc, uint64(stats.counters.collections),
+			time.Duration(stats.counters.collectNanos).Seconds(), nil, stats.id)
+		ch <- prometheus.MustNewConstMetric(statsBacklogDesc, prometheus.GaugeValue, float64(stats.backlog), stats.id)
+	}
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// noCleanUpClock is a fake clock that never runs the scheduled clean-ups, so that expired metrics remain in the vectors.
+type noCleanUpClock struct {
+	*metricstest.FakeClock
+}
+
+func (c noCleanUpClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return func() bool { return true }
+}
+
+func TestStatsCollector(t *testing.T) {
+	t.Parallel()
+
+	clock := noCleanUpClock{metricstest.NewFakeClock(defaultTime)}
+	stats := NewStatsCollector()
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		WarmUpDuration:  time.Second,
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+		VectorOpts: VectorOpts{
+			AdmissionThreshold: 2,
+			Stats:              stats,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	for _, label := range []string{"toto", "toto", "titi", "titi", "tata", "tutu", "tutu"} {
+		counter.WithLabelValues(label).Inc()
+	}
+	testutil.CollectAndCount(counter)
+	counter.WithLabelValues("tyty").Inc()
+	counter.WithLabelValues("tyty").Inc()
+	clock.Advance(2 * time.Second)
+	testutil.CollectAndCount(counter)
+	counter.DeleteLabelValues("tutu")
+
+	expect := `
+# HELP smart_vector_series Number of series held by the vector, by state.
+# TYPE smart_vector_series gauge
+smart_vector_series{state="pending_admission",vector="namespace_count"} 1
+smart_vector_series{state="warm_up_complete",vector="namespace_count"} 3
+smart_vector_series{state="warm_up_ongoing",vector="namespace_count"} 1
+smart_vector_series{state="warm_up_pending",vector="namespace_count"} 0
+# HELP smart_vector_lifecycles_created_total Number of life cycles started by the vector, i.e. metrics created.
+# TYPE smart_vector_lifecycles_created_total counter
+smart_vector_lifecycles_created_total{vector="namespace_count"} 5
+# HELP smart_vector_deletions_total Number of metrics deleted from the vector by the application.
+# TYPE smart_vector_deletions_total counter
+smart_vector_deletions_total{vector="namespace_count"} 1
+# HELP smart_vector_expirations_total Number of metrics removed from the vector because they expired.
+# TYPE smart_vector_expirations_total counter
+smart_vector_expirations_total{vector="namespace_count"} 0
+# HELP smart_vector_cleanup_backlog Number of metrics of the vector past their deadline, waiting for the next clean-up.
+# TYPE smart_vector_cleanup_backlog gauge
+smart_vector_cleanup_backlog{vector="namespace_count"} 0
+`
+	err := testutil.CollectAndCompare(stats, strings.NewReader(expect), "smart_vector_series",
+		"smart_vector_lifecycles_created_total", "smart_vector_deletions_total", "smart_vector_expirations_total",
+		"smart_vector_cleanup_backlog")
+	assert.NoError(t, err)
+
+	// the expired metrics are reported till they are removed, including the overflow metric counting the updates of
+	// the label values pending admission
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, 3.0, gatherStat(t, stats, "smart_vector_cleanup_backlog"))
+	testutil.CollectAndCount(counter)
+	// the metric that completed its warm-up with this collection has already expired as well
+	assert.Equal(t, 1.0, gatherStat(t, stats, "smart_vector_cleanup_backlog"))
+	assert.Equal(t, 3.0, gatherStat(t, stats, "smart_vector_expirations_total"))
+
+	// the collections are timed
+	assert.Equal(t, 3.0, gatherStat(t, stats, "smart_vector_collect_duration_seconds"))
+}
+
+// gatherStat returns the value of the given statistic of the first vector of the collector
+// (the number of observations for the collect duration).
+func gatherStat(t *testing.T, stats *StatsCollector, name string) float64 {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(stats)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		metric := family.GetMetric()[0]
+		switch {
+		case metric.Gauge != nil:
+			return metric.Gauge.GetValue()
+		case metric.Counter != nil:
+			return metric.Counter.GetValue()
+		case metric.Summary != nil:
+			return float64(metric.Summary.GetSampleCount())
+		}
+	}
+	t.Fatalf("statistic %s not found", name)
+	return 0
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxStripes is the maximum number of cells of a striped counter.
+const maxStripes = 64
+
+// stripeCount is the number of cells of the striped counters: the number of Ps rounded up to a power of 2.
+var stripeCount = func() int {
+	count := 1
+	for count < runtime.GOMAXPROCS(0) && count < maxStripes {
+		count *= 2
+	}
+	return count
+}()
+
+// stripeToken identifies the cell used by a goroutine. The tokens are kept in a sync.Pool whose cache is per P,
+// so that the goroutines running on the same P mostly get the same token, and different Ps different tokens.
+type stripeToken struct {
+	index uint32
+}
+
+var (
+	nextStripeIndex uint32
+	stripeTokens    = sync.Pool{New: func() any {
+		return &stripeToken{index: atomic.AddUint32(&nextStripeIndex, 1)}
+	}}
+)
+
+// counterCell is a part of the value of a striped counter, padded to its own cache line.
+type counterCell struct {
+	// valBits contains the bits of a float64 value, while valInt stores values that are exact integers.
+	// Both have to go first in the struct to guarantee alignment for atomic operations.
+	valBits uint64
+	valInt  uint64
+	_       [48]byte
+}
+
+// stripedCounter is a [prometheus.Counter] that spreads its increments over per-P cells to avoid the contention of
+// concurrent updates, and sums them when collected. It trades memory (a cache line per P) for write throughput.
+type stripedCounter struct {
+	desc       *prometheus.Desc
+	labelPairs []*dto.LabelPair
+	cells      []counterCell
+}
+
+func newStripedCounter(desc *prometheus.Desc, labelValues ...string) *stripedCounter {
+	return &stripedCounter{
+		desc:       desc,
+		labelPairs: prometheus.MakeLabelPairs(desc, labelValues),
+		cells:      make([]counterCell, stripeCount),
+	}
+}
+
+func newStripedCounterDesc(opts prometheus.CounterOpts, labelNames []string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		labelNames,
+		opts.ConstLabels,
+	)
+}
+
+func (c *stripedCounter) cell() *counterCell {
+	token := stripeTokens.Get().(*stripeToken)
+	cell := &c.cells[token.index&uint32(len(c.cells)-1)]
+	stripeTokens.Put(token)
+	return cell
+}
+
+// Desc implements [prometheus.Metric].
+func (c *stripedCounter) Desc() *prometheus.Desc {
+	return c.desc
+}
+
+// Inc implements [prometheus.Counter].
+func (c *stripedCounter) Inc() {
+	atomic.AddUint64(&c.cell().valInt, 1)
+}
+
+// Add implements [prometheus.Counter]. It panics if the value is < 0.
+func (c *stripedCounter) Add(v float64) {
+	if v < 0 {
+		panic(errors.New("counter cannot decrease in value"))
+	}
+	cell := c.cell()
+	ival := uint64(v)
+	if float64(ival) == v {
+		atomic.AddUint64(&cell.valInt, ival)
+		return
+	}
+	for {
+		oldBits := atomic.LoadUint64(&cell.valBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&cell.valBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+func (c *stripedCounter) get() float64 {
+	var value float64
+	var ival uint64
+	for i := range c.cells {
+		value += math.Float64frombits(atomic.LoadUint64(&c.cells[i].valBits))
+		ival += atomic.LoadUint64(&c.cells[i].valInt)
+	}
+	return value + float64(ival)
+}
+
+// Write implements [prometheus.Metric].
+func (c *stripedCounter) Write(out *dto.Metric) error {
+	value := c.get()
+	out.Label = c.labelPairs
+	out.Counter = &dto.Counter{Value: &value}
+	return nil
+}
+
+// Describe implements [prometheus.Collector].
+func (c *stripedCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements [prometheus.Collector].
+func (c *stripedCounter) Collect(ch chan<- prometheus.Metric) {
+	ch <- c
+}
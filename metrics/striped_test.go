@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripedCounter_ConcurrentAdd(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock:   clock,
+		Striped: true,
+	}
+	counter := NewCounter(opts)
+	testutil.CollectAndCount(counter)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				counter.Inc()
+				counter.Add(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	clock.Advance(1)
+	assert.Equal(t, 12000.0, testutil.ToFloat64(counter))
+	assert.Panics(t, func() { counter.Add(-1) })
+}
+
+func TestStripedCounterVec_WarmUpAndExpiration(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace:   "namespace",
+			Subsystem:   "something",
+			Name:        "count",
+			Help:        "Help message",
+			ConstLabels: prometheus.Labels{"app": "test"},
+		},
+		WarmUpDuration:  10 * time.Second,
+		ExpirationDelay: time.Minute,
+		RollupLabels:    prometheus.Labels{"label": "__expired__"},
+		Clock:           clock,
+		Striped:         true,
+	}
+	counter := NewCounterVec(opts, []string{"label"})
+	counter.WithLabelValues("toto").Add(2)
+	counter.WithLabelValues("titi").Inc()
+
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",app="test",label="titi"} 0
+		namespace_something_count{_tag_="48ab9774",app="test",label="toto"} 0
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	clock.Advance(11 * time.Second)
+	counter.WithLabelValues("toto").Add(1.5)
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",app="test",label="titi"} 1
+		namespace_something_count{_tag_="48ab9774",app="test",label="toto"} 3.5
+		`
+	err = testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	clock.Advance(59 * time.Second)
+	counter.WithLabelValues("toto").Inc()
+	clock.Advance(10 * time.Second)
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",app="test",label="toto"} 4.5
+		namespace_something_count{_tag_="48ab97c4",app="test",label="__expired__"} 1
+		`
+	err = testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+}
+
+func BenchmarkStripedCounter_ParallelInc(b *testing.B) {
+	counter := NewCounter(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Striped:     true,
+	})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.Inc()
+		}
+	})
+}
+
+// BenchmarkCounter_ParallelInc is the reference for BenchmarkStripedCounter_ParallelInc.
+func BenchmarkCounter_ParallelInc(b *testing.B) {
+	counter := NewCounter(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+	})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.Inc()
+		}
+	})
+}
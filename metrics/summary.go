@@ -15,6 +15,11 @@ type SummaryOpts struct {
 	// ExpirationDelay is the maximum times a metrics keeps beeing collected when it not accessed/updated anymore.
 	// It is only applicable to vector of metrics and zero value means infinite expiration time.
 	ExpirationDelay time.Duration
+	// Clock provides the time to the metrics (the system clock by default).
+	// It is mainly useful to control the time in tests, see metricstest.FakeClock.
+	Clock Clock
+	// VectorOpts are the options only applicable to vector of metrics.
+	VectorOpts
 }
 
 func createSummaryMetricOpts(opts SummaryOpts) metricOpts {
@@ -25,7 +30,9 @@ func createSummaryMetricOpts(opts SummaryOpts) metricOpts {
 	initialMetric := func(metric prometheus.Metric, labelValues []string) prometheus.Metric {
 		return prometheus.MustNewConstSummary(metric.Desc(), 0, 0, initialQuantiles, labelValues...)
 	}
-	return metricOpts{InitialMetric: initialMetric, WarmUpDuration: opts.WarmUpDuration, ExpirationDelay: opts.ExpirationDelay}
+	return metricOpts{FQName: prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), ConstLabels: opts.ConstLabels,
+		InitialMetric: initialMetric, WarmUpDuration: opts.WarmUpDuration, ExpirationDelay: opts.ExpirationDelay,
+		Clock: opts.Clock, VectorOpts: opts.VectorOpts}
 }
 
 type summary struct {
@@ -45,6 +52,13 @@ func (s *summary) Collect(ch chan<- prometheus.Metric) {
 	s.singleCollector.Collect(ch)
 }
 
+// Observe implements [prometheus.Summary], doing nothing while the summary is disabled.
+func (s *summary) Observe(value float64) {
+	if s.Enabled() {
+		s.Summary.Observe(value)
+	}
+}
+
 // NewSummaryVec created a new vector of [prometheus.Summary] metrics with the Warmup and expiration features.
 func NewSummaryVec(opts SummaryOpts, labelNames []string) *MetricVec[prometheus.Summary] {
 	promVecFactory := func(labelNames []string) *prometheus.MetricVec {
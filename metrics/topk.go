@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTopKInterval   = time.Minute
+	defaultTopKOtherValue = "__other__"
+	// topKShardCount is the number of shards of the activity of a topKTracker, it must be a power of 2.
+	topKShardCount = 16
+	// topKCapacityFactor is the number of label values tracked by the activity of a topKTracker, per member.
+	topKCapacityFactor = 4
+)
+
+// topKEntry is the activity of a set of label values in a topKShard.
+type topKEntry struct {
+	hash        uint64
+	labelValues []string
+	// estimated number of accesses in the current period
+	hits uint64
+	// index of the entry in the heap of its shard
+	index int
+	// next entry whose label values have the same hash
+	next *topKEntry
+}
+
+// topKHeap is a min-heap of the entries of a topKShard by number of accesses.
+type topKHeap []*topKEntry
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].hits < h[j].hits }
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x any) {
+	entry := x.(*topKEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *topKHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// topKShard tracks the activity of the label values hashing to the shard with the Space-Saving algorithm: at most
+// capacity label values are tracked, a new label values replacing the least active ones and inheriting their number
+// of accesses. The label values accessed more than 1/capacity of the accesses of the shard are always tracked.
+type topKShard struct {
+	mutex   sync.Mutex
+	entries map[uint64]*topKEntry
+	heap    topKHeap
+}
+
+// must be called holding s.mutex
+func (s *topKShard) hit(hash uint64, labelValues []string, capacity int) {
+	for entry := s.entries[hash]; entry != nil; entry = entry.next {
+		if equalStrings(entry.labelValues, labelValues) {
+			entry.hits++
+			heap.Fix(&s.heap, entry.index)
+			return
+		}
+	}
+	if len(s.heap) < capacity {
+		entry := &topKEntry{hash: hash, labelValues: append([]string(nil), labelValues...), hits: 1}
+		s.link(entry)
+		heap.Push(&s.heap, entry)
+		return
+	}
+	// replace the least active entry, reusing it
+	entry := s.heap[0]
+	s.unlink(entry)
+	entry.hash = hash
+	entry.labelValues = append(entry.labelValues[:0], labelValues...)
+	entry.hits++
+	s.link(entry)
+	heap.Fix(&s.heap, 0)
+}
+
+func (s *topKShard) link(entry *topKEntry) {
+	entry.next = s.entries[entry.hash]
+	s.entries[entry.hash] = entry
+}
+
+func (s *topKShard) unlink(entry *topKEntry) {
+	if first := s.entries[entry.hash]; first == entry {
+		if entry.next == nil {
+			delete(s.entries, entry.hash)
+		} else {
+			s.entries[entry.hash] = entry.next
+		}
+	} else {
+		for prev := first; prev != nil; prev = prev.next {
+			if prev.next == entry {
+				prev.next = entry.next
+				break
+			}
+		}
+	}
+	entry.next = nil
+}
+
+// reset clears the activity of the shard and returns its entries.
+//
+// must be called holding s.mutex
+func (s *topKShard) reset() []*topKEntry {
+	entries := s.heap
+	s.entries = make(map[uint64]*topKEntry)
+	s.heap = nil
+	return entries
+}
+
+// topKMembers are the label values exported as individual metrics, indexed by their hash. It is never modified
+// once published, so that it can be read without lock.
+type topKMembers struct {
+	byHash map[uint64][]string
+}
+
+func (m *topKMembers) contains(hash uint64, labelValues []string) bool {
+	members, found := m.byHash[hash]
+	return found && equalStrings(members, labelValues)
+}
+
+// topKTracker tracks the activity of the label values of a vector in top-K mode and decides which of them are
+// exported as individual metrics (the members), the other ones being folded into the "other" metric.
+//
+// The activity of the current period is tracked in a bounded memory (about topKCapacityFactor*K label values),
+// sharded like the vector, and accessing a member takes no allocation.
+type topKTracker struct {
+	// start of the next period, in unix nanoseconds, accessed atomically
+	nextUpdate  int64
+	k           int
+	capacity    int
+	interval    time.Duration
+	otherValues []string
+	shards      [topKShardCount]topKShard
+	// current *topKMembers, replaced on change
+	members atomic.Value
+	// serializes the changes of the members
+	mutex sync.Mutex
+}
+
+func newTopKTracker(opts VectorOpts, labelCount int, now time.Time) *topKTracker {
+	interval := opts.TopKInterval
+	if interval <= 0 {
+		interval = defaultTopKInterval
+	}
+	otherValue := opts.TopKOtherValue
+	if otherValue == "" {
+		otherValue = defaultTopKOtherValue
+	}
+	otherValues := make([]string, labelCount)
+	for i := range otherValues {
+		otherValues[i] = otherValue
+	}
+	t := &topKTracker{
+		nextUpdate:  now.Add(interval).UnixNano(),
+		k:           opts.TopK,
+		capacity:    topKCapacityFactor * (opts.TopK/topKShardCount + 1),
+		interval:    interval,
+		otherValues: otherValues,
+	}
+	for i := range t.shards {
+		t.shards[i].entries = make(map[uint64]*topKEntry)
+	}
+	t.members.Store(&topKMembers{byHash: make(map[uint64][]string)})
+	return t
+}
+
+// hit counts an access to the given label values and returns true if they are exported as an individual metric.
+// As long as there are less than K members, new label values become members right away.
+func (t *topKTracker) hit(labelValues []string) bool {
+	hash := hashStringSlice(labelValues)
+	shard := &t.shards[hash&(topKShardCount-1)]
+	shard.mutex.Lock()
+	shard.hit(hash, labelValues, t.capacity)
+	shard.mutex.Unlock()
+
+	members := t.members.Load().(*topKMembers)
+	if members.contains(hash, labelValues) {
+		return true
+	}
+	if len(members.byHash) >= t.k {
+		return false
+	}
+	return t.addMember(hash, labelValues)
+}
+
+// addMember adds new label values to the members if there are less than K members.
+func (t *topKTracker) addMember(hash uint64, labelValues []string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	members := t.members.Load().(*topKMembers)
+	if members.contains(hash, labelValues) {
+		return true
+	}
+	if _, found := members.byHash[hash]; found || len(members.byHash) >= t.k {
+		return false
+	}
+	byHash := make(map[uint64][]string, len(members.byHash)+1)
+	for h, values := range members.byHash {
+		byHash[h] = values
+	}
+	byHash[hash] = append([]string(nil), labelValues...)
+	t.members.Store(&topKMembers{byHash: byHash})
+	return true
+}
+
+// due returns true when the current period is over.
+func (t *topKTracker) due(now time.Time) bool {
+	return now.UnixNano() >= atomic.LoadInt64(&t.nextUpdate)
+}
+
+// update recomputes the members from the activity of the period that just ended, when due.
+// It returns the label values that are not members anymore. Only one of concurrent calls does the update.
+func (t *topKTracker) update(now time.Time) [][]string {
+	next := atomic.LoadInt64(&t.nextUpdate)
+	if now.UnixNano() < next || !atomic.CompareAndSwapInt64(&t.nextUpdate, next, now.Add(t.interval).UnixNano()) {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var entries []*topKEntry
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.mutex.Lock()
+		entries = append(entries, shard.reset()...)
+		shard.mutex.Unlock()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].hits > entries[j].hits
+	})
+	// the entries are not tracked anymore, their label values can be kept
+	byHash := make(map[uint64][]string, t.k)
+	for _, entry := range entries {
+		if len(byHash) >= t.k {
+			break
+		}
+		if _, found := byHash[entry.hash]; !found {
+			byHash[entry.hash] = entry.labelValues
+		}
+	}
+	members := &topKMembers{byHash: byHash}
+
+	var removed [][]string
+	for hash, labelValues := range t.members.Load().(*topKMembers).byHash {
+		if !members.contains(hash, labelValues) {
+			removed = append(removed, labelValues)
+		}
+	}
+	t.members.Store(members)
+	return removed
+}
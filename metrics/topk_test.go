@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_TopK(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Namespace: "namespace",
+			Subsystem: "something",
+			Name:      "count",
+			Help:      "Help message",
+		},
+		Clock: clock,
+		VectorOpts: VectorOpts{
+			TopK:         2,
+			TopKInterval: 10 * time.Second,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"customer", "region"})
+
+	// The first label values fill the top-K, the next ones go to the "other" metric
+	counter.WithLabelValues("c1", "eu").Add(3)
+	counter.WithLabelValues("c2", "us").Add(2)
+	counter.WithLabelValues("c3", "us").Add(1)
+	counter.WithLabelValues("c3", "us").Add(1)
+	counter.WithLabelValues("c3", "us").Add(1)
+
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+	expect := `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",customer="c1",region="eu"} 3
+		namespace_something_count{_tag_="48ab9774",customer="c2",region="us"} 2
+		namespace_something_count{_tag_="48ab9774",customer="__other__",region="__other__"} 3
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	// At the end of the period, c3 has been more active than c2 that is removed
+	counter.WithLabelValues("c1", "eu").Add(1)
+	clock.Advance(11*time.Second - 1)
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",customer="c1",region="eu"} 4
+		namespace_something_count{_tag_="48ab9774",customer="__other__",region="__other__"} 3
+		namespace_something_count{_tag_="48ab977f",customer="__other__",region="__other__"} 2
+		`
+	err = testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+
+	// c3 now has its own metric starting a new life cycle (whose tag follows the one of the series of the dropouts),
+	// while c2 goes to the "other" metric
+	counter.WithLabelValues("c3", "us").Add(5)
+	counter.WithLabelValues("c2", "us").Add(2)
+	testutil.CollectAndCount(counter)
+	clock.Advance(time.Second)
+	expect = `
+		# HELP namespace_something_count Help message
+		# TYPE namespace_something_count counter
+		namespace_something_count{_tag_="48ab9774",customer="c1",region="eu"} 4
+		namespace_something_count{_tag_="48ab9780",customer="c3",region="us"} 5
+		namespace_something_count{_tag_="48ab9774",customer="__other__",region="__other__"} 5
+		namespace_something_count{_tag_="48ab977f",customer="__other__",region="__other__"} 2
+		`
+	err = testutil.CollectAndCompare(counter, strings.NewReader(expect), "namespace_something_count")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_TopKAdvancesOnAccess(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock: clock,
+		VectorOpts: VectorOpts{
+			TopK:         1,
+			TopKInterval: 10 * time.Second,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"customer"})
+	counter.WithLabelValues("c1").Inc()
+	counter.WithLabelValues("c2").Inc()
+	counter.WithLabelValues("c2").Inc()
+
+	// without any collection, c2 replaces c1 at its first access after the end of the period
+	clock.Advance(10 * time.Second)
+	counter.WithLabelValues("c2").Inc()
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+	expect := `
+		# HELP count Help message
+		# TYPE count counter
+		count{_tag_="48ab9774",customer="__other__"} 2
+		count{_tag_="48ab977e",customer="__other__"} 1
+		count{_tag_="48ab977f",customer="c2"} 1
+		`
+	err := testutil.CollectAndCompare(counter, strings.NewReader(expect), "count")
+	assert.NoError(t, err)
+}
+
+func TestCounterVec_TopKDropOutAndOtherInSameSecond(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	counter := NewCounterVec(CounterOpts{
+		CounterOpts:     prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		ExpirationDelay: 5 * time.Second,
+		Clock:           clock,
+		VectorOpts:      VectorOpts{TopK: 2, TopKInterval: time.Minute},
+	}, []string{"customer"})
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(counter)
+	access := func(customer string, count int) {
+		for i := 0; i < count; i++ {
+			counter.WithLabelValues(customer).Inc()
+		}
+	}
+	access("c1", 3)
+	access("c2", 2)
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+	testutil.CollectAndCount(counter)
+
+	// c3 is counted in the "other" metric, that expires before the end of the period while c2 is still accessed
+	clock.Advance(time.Minute)
+	access("c1", 3)
+	access("c3", 3)
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+	testutil.CollectAndCount(counter)
+	clock.Advance(58 * time.Second)
+	access("c2", 1)
+
+	// c2 drops out and is folded into a new "other" series within the same second as the creation of a new live "other"
+	// metric by a non-member access
+	clock.Advance(2 * time.Second)
+	access("c3", 1)
+	access("c4", 1)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	tags := map[string]bool{}
+	for _, metric := range families[0].GetMetric() {
+		labels := map[string]string{}
+		for _, pair := range metric.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if labels["customer"] == "__other__" {
+			tags[labels[LabelLifeCycleTag]] = true
+		}
+	}
+	assert.Len(t, tags, 2)
+}
+
+func TestCounterVec_TopKOtherRollupTagGenerator(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	var generated int
+	counter := NewCounterVec(CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Clock:       clock,
+		VectorOpts: VectorOpts{
+			TopK:         1,
+			TopKInterval: 10 * time.Second,
+			TagGenerator: func(now time.Time, labelValues []string) string {
+				generated++
+				return "g" + strconv.Itoa(generated)
+			},
+		},
+	}, []string{"customer"})
+	counter.WithLabelValues("c1").Inc()
+	counter.WithLabelValues("c2").Inc()
+	counter.WithLabelValues("c2").Inc()
+	clock.Advance(10 * time.Second)
+	counter.WithLabelValues("c2").Inc()
+	testutil.CollectAndCount(counter)
+	clock.Advance(1)
+
+	// the series of the dropouts is tagged by the TagGenerator as well
+	expect := `
+		# HELP count Help message
+		# TYPE count counter
+		count{_tag_="g2",customer="__other__"} 2
+		count{_tag_="g3",customer="__other__"} 1
+		count{_tag_="g4",customer="c2"} 1
+		`
+	assert.NoError(t, testutil.CollectAndCompare(counter, strings.NewReader(expect), "count"))
+}
+
+func TestTopKTracker_Bounded(t *testing.T) {
+	t.Parallel()
+
+	tracker := newTopKTracker(VectorOpts{TopK: 2}, 1, defaultTime)
+	for i := 0; i < 10000; i++ {
+		tracker.hit([]string{strconv.Itoa(i)})
+		tracker.hit([]string{"hot"})
+	}
+	count := 0
+	for i := range tracker.shards {
+		assert.LessOrEqual(t, len(tracker.shards[i].heap), tracker.capacity)
+		count += len(tracker.shards[i].heap)
+	}
+	assert.LessOrEqual(t, count, topKShardCount*tracker.capacity)
+
+	// the label values accessed most often are always tracked
+	assert.Equal(t, [][]string{{"0"}}, tracker.update(defaultTime.Add(time.Hour)))
+	members := tracker.members.Load().(*topKMembers)
+	assert.True(t, members.contains(hashStringSlice([]string{"hot"}), []string{"hot"}))
+}
+
+func TestCounterVec_TopKMemberDoesNotAllocate(t *testing.T) {
+	opts := CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name: "count",
+			Help: "Help message",
+		},
+		Clock: metricstest.NewFakeClock(defaultTime),
+		VectorOpts: VectorOpts{
+			TopK: 2,
+		},
+	}
+	counter := NewCounterVec(opts, []string{"method", "code"})
+	counter.WithLabelValues("GET", "200").Inc()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		counter.WithLabelValues("GET", "200").Inc()
+	})
+	assert.Equal(t, 0.0, allocs)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelTTL overrides the expiration delay of the metrics of a vector having the given label values,
+// see VectorOpts.LabelTTLs.
+type LabelTTL struct {
+	// Labels are the label values of the matching metrics, a subset of the labels of the vector
+	// (e.g. prometheus.Labels{"job": "batch"}).
+	Labels prometheus.Labels
+	// ExpirationDelay is the expiration delay of the matching metrics, zero value meaning that they never expire.
+	ExpirationDelay time.Duration
+}
+
+// labelTTLRule is a LabelTTL resolved against the labels of a vector.
+type labelTTLRule struct {
+	indexes []int
+	values  []string
+	delay   time.Duration
+}
+
+// newLabelTTLRules resolves the given LabelTTLs, dropping the ones having a label that is not a label of the vector.
+func newLabelTTLRules(labelNames []string, ttls []LabelTTL) []labelTTLRule {
+	var rules []labelTTLRule
+	for _, ttl := range ttls {
+		rule := labelTTLRule{delay: ttl.ExpirationDelay}
+		for name, value := range ttl.Labels {
+			i := indexOf(labelNames, name)
+			if i < 0 {
+				rule.indexes = nil
+				break
+			}
+			rule.indexes = append(rule.indexes, i)
+			rule.values = append(rule.values, value)
+		}
+		if len(rule.indexes) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (r labelTTLRule) matches(labelValues []string) bool {
+	for j, i := range r.indexes {
+		if labelValues[i] != r.values[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// labelTTL returns the expiration delay given by the first LabelTTL matching the label values of a new metric.
+// It returns false when no rule matches, the expiration delay of the vector applying.
+func (mv *MetricVec[M]) labelTTL(labelValues []string) (time.Duration, bool) {
+	for _, rule := range mv.labelTTLs {
+		if rule.matches(labelValues) {
+			return rule.delay, true
+		}
+	}
+	return 0, false
+}
+
+// minLabelTTL returns the shortest non-zero expiration delay given by the LabelTTLs of the vector, zero if none.
+func (mv *MetricVec[M]) minLabelTTL() time.Duration {
+	var shortest time.Duration
+	for _, rule := range mv.labelTTLs {
+		if rule.delay > 0 && (shortest == 0 || rule.delay < shortest) {
+			shortest = rule.delay
+		}
+	}
+	return shortest
+}
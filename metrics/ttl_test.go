@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGaugeVec_LabelTTLs(t *testing.T) {
+	t.Parallel()
+
+	clock := metricstest.NewFakeClock(defaultTime)
+	gauge := NewGaugeVec(GaugeOpts{
+		GaugeOpts: prometheus.GaugeOpts{
+			Name: "jobs",
+			Help: "Help message",
+		},
+		ExpirationDelay: time.Hour,
+		Clock:           clock,
+		VectorOpts: VectorOpts{
+			LabelTTLs: []LabelTTL{
+				{Labels: prometheus.Labels{"kind": "batch", "region": "eu"}, ExpirationDelay: 10 * time.Second},
+				{Labels: prometheus.Labels{"kind": "batch"}, ExpirationDelay: 20 * time.Second},
+				{Labels: prometheus.Labels{"unknown": "batch"}, ExpirationDelay: time.Second},
+			},
+		},
+	}, []string{"kind", "region"})
+	gauge.WithLabelValues("batch", "eu").Set(1)
+	gauge.WithLabelValues("batch", "us").Set(1)
+	gauge.WithLabelValues("web", "eu").Set(1)
+	// the metrics can expire once their warm-up is complete
+	testutil.CollectAndCount(gauge)
+	clock.Advance(1)
+	testutil.CollectAndCount(gauge)
+
+	expiresIn := func() map[string]time.Duration {
+		delays := map[string]time.Duration{}
+		for _, info := range gauge.Inspect() {
+			delays[info.LabelValues[0]+"/"+info.LabelValues[1]] = info.ExpiresAt.Sub(defaultTime)
+		}
+		return delays
+	}
+	assert.Equal(t, map[string]time.Duration{
+		"batch/eu": 10 * time.Second,
+		"batch/us": 20 * time.Second,
+		"web/eu":   time.Hour,
+	}, expiresIn())
+
+	// the rules are not changed by the expiration delay of the vector
+	gauge.SetExpirationDelay(30 * time.Minute)
+	clock.Advance(11 * time.Second)
+	assert.Equal(t, map[string]time.Duration{
+		"batch/us": 20 * time.Second,
+		"web/eu":   30 * time.Minute,
+	}, expiresIn())
+	clock.Advance(20 * time.Second)
+	assert.Equal(t, 1, testutil.CollectAndCount(gauge))
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type UntypedOpts struct {
+	prometheus.UntypedOpts
+	// ExpirationDelay is the maximum times a metrics keeps beeing collected when it not accessed/updated anymore.
+	// It is only applicable to vector of metrics and zero value means infinite expiration time.
+	ExpirationDelay time.Duration
+	// Clock provides the time to the metrics (the system clock by default).
+	// It is mainly useful to control the time in tests, see metricstest.FakeClock.
+	Clock Clock
+	// VectorOpts are the options only applicable to vector of metrics.
+	VectorOpts
+}
+
+// Untyped is a metric of unknown type, e.g. to mirror an external metric. It works like a [prometheus.Gauge]
+// but the collected metric is of type "Untyped".
+type Untyped interface {
+	prometheus.Gauge
+}
+
+func createUntypedMetricOpts(opts UntypedOpts) metricOpts {
+	initialMetric := func(metric prometheus.Metric, labelValues []string) prometheus.Metric {
+		// like for Gauge, the warmup mechanism is disabled returning the metric itself as initial value
+		return metric
+	}
+	return metricOpts{FQName: prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), ConstLabels: opts.ConstLabels,
+		InitialMetric: initialMetric, ExpirationDelay: opts.ExpirationDelay, Clock: opts.Clock, VectorOpts: opts.VectorOpts}
+}
+
+// untyped implements Untyped, the way prometheus implements its gauges.
+type untyped struct {
+	// valBits contains the bits of the float64 value, it has to go first in the struct to guarantee alignment for
+	// atomic operations.
+	valBits    uint64
+	desc       *prometheus.Desc
+	labelPairs []*dto.LabelPair
+}
+
+func newUntyped(desc *prometheus.Desc, labelValues ...string) *untyped {
+	return &untyped{desc: desc, labelPairs: prometheus.MakeLabelPairs(desc, labelValues)}
+}
+
+// Desc implements [prometheus.Metric].
+func (u *untyped) Desc() *prometheus.Desc {
+	return u.desc
+}
+
+// Set implements [prometheus.Gauge].
+func (u *untyped) Set(v float64) {
+	atomic.StoreUint64(&u.valBits, math.Float64bits(v))
+}
+
+// SetToCurrentTime implements [prometheus.Gauge].
+func (u *untyped) SetToCurrentTime() {
+	u.Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+// Inc implements [prometheus.Gauge].
+func (u *untyped) Inc() {
+	u.Add(1)
+}
+
+// Dec implements [prometheus.Gauge].
+func (u *untyped) Dec() {
+	u.Add(-1)
+}
+
+// Add implements [prometheus.Gauge].
+func (u *untyped) Add(v float64) {
+	for {
+		oldBits := atomic.LoadUint64(&u.valBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&u.valBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// Sub implements [prometheus.Gauge].
+func (u *untyped) Sub(v float64) {
+	u.Add(-v)
+}
+
+// Write implements [prometheus.Metric].
+func (u *untyped) Write(out *dto.Metric) error {
+	value := math.Float64frombits(atomic.LoadUint64(&u.valBits))
+	out.Label = u.labelPairs
+	out.Untyped = &dto.Untyped{Value: &value}
+	return nil
+}
+
+// Describe implements [prometheus.Collector].
+func (u *untyped) Describe(ch chan<- *prometheus.Desc) {
+	ch <- u.desc
+}
+
+// Collect implements [prometheus.Collector].
+func (u *untyped) Collect(ch chan<- prometheus.Metric) {
+	ch <- u
+}
+
+// NewUntypedVec created a new vector of Untyped metrics with expiration features.
+// The prometheus package has no equivalent vector.
+func NewUntypedVec(opts UntypedOpts, labelNames []string) *MetricVec[Untyped] {
+	promVecFactory := func(labelNames []string) *prometheus.MetricVec {
+		desc := prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			labelNames,
+			opts.ConstLabels,
+		)
+		return prometheus.NewMetricVec(desc, func(labelValues ...string) prometheus.Metric {
+			return newUntyped(desc, labelValues...)
+		})
+	}
+	return newMetricVec[Untyped](promVecFactory, createUntypedMetricOpts(opts), labelNames)
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUntypedVec(t *testing.T) {
+	clock := metricstest.NewFakeClock(defaultTime)
+	vec := NewUntypedVec(UntypedOpts{
+		UntypedOpts:     prometheus.UntypedOpts{Name: "external", Help: "Help message"},
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+	}, []string{"source"})
+
+	vec.WithLabelValues("a").Set(3)
+	vec.WithLabelValues("a").Add(2)
+	vec.WithLabelValues("b").Dec()
+
+	expect := `
+		# HELP external Help message
+		# TYPE external untyped
+		external{_tag_="48ab9774",source="a"} 5
+		external{_tag_="48ab9774",source="b"} -1
+		`
+	assert.NoError(t, testutil.CollectAndCompare(vec, strings.NewReader(expect)))
+
+	// the metrics expire once their warm-up is complete
+	clock.Advance(time.Second)
+	assert.Equal(t, 2, testutil.CollectAndCount(vec))
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, 0, testutil.CollectAndCount(vec))
+}
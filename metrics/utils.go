@@ -1,6 +1,18 @@
 package metrics
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// keySep separates the label values in the keys returned by labelValuesKey.
+// It is not a valid UTF-8 sequence and cannot be part of a label value.
+const keySep = "\xff"
+
+// labelValuesKey returns a string that can be used as map key for the given label values.
+func labelValuesKey(labelValues []string) string {
+	return strings.Join(labelValues, keySep)
+}
 
 func equalStrings(s1 []string, s2 []string) bool {
 	if s1 == nil && s2 == nil {
@@ -17,6 +29,15 @@ func equalStrings(s1 []string, s2 []string) bool {
 	return true
 }
 
+func indexOf(list []string, s string) int {
+	for i, val := range list {
+		if val == s {
+			return i
+		}
+	}
+	return -1
+}
+
 // nowFunc allows altering the result of Now for testing
 var nowFunc func() time.Time
 
@@ -26,6 +47,9 @@ func init() {
 
 // SetUpNowTime overrides the 'now' time seen by this library to a constant value (instead of time.Now)
 // This function is provided only to ease unit testing
+//
+// Deprecated: the global 'now' time is shared by all the metrics and changing it is not safe for concurrent use.
+// Use the Clock option of the metrics instead, with a metricstest.FakeClock.
 func SetUpNowTime(t time.Time) {
 	nowFunc = func() time.Time {
 		return t
@@ -33,6 +57,8 @@ func SetUpNowTime(t time.Time) {
 }
 
 // RestoreNowTime restores the 'now' time seen by this library to time.Now.
+//
+// Deprecated: use the Clock option of the metrics instead, see SetUpNowTime.
 func RestoreNowTime() {
 	nowFunc = time.Now
 }
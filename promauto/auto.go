@@ -20,12 +20,13 @@
 // limitations under the License.
 
 // Package promauto provides alternative constructors for the fundamental
-// Prometheus metric types and their …Vec ( …Func variants or not implemented)
+// Prometheus metric types and their …Vec and …Func variants
 //
 // This is a modified version of the original [prometheus.promauto] package that adds supports for "smart metrics" of this library
 package promauto
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/goto-opensource/smart-prometheus-client/metrics"
@@ -40,6 +41,11 @@ type SmartMetricOpts struct {
 	// ExpirationDelay is the maximum times a metrics keeps beeing collected when it not accessed/updated anymore.
 	// It is only applicable to vector of metrics and zero value means infinite expiration time.
 	ExpirationDelay time.Duration
+	// Clock provides the time to the metrics (the system clock by default).
+	// It is mainly useful to control the time in tests, see metricstest.FakeClock.
+	Clock metrics.Clock
+	// VectorOpts are the options only applicable to vector of metrics.
+	metrics.VectorOpts
 }
 
 // DefaultOptions are the default 'Smart metrics' options used by all the package level NewXXX functions
@@ -49,9 +55,9 @@ var DefaultOptions SmartMetricOpts
 // but it automatically registers the Counter with the
 // prometheus.DefaultRegisterer. If the registration fails, NewCounter panics.
 //
-// It used the default options DefaultOptions
-func NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
-	return With(prometheus.DefaultRegisterer).NewCounter(opts)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewCounter(opts prometheus.CounterOpts, options ...Option) prometheus.Counter {
+	return With(prometheus.DefaultRegisterer).NewCounter(opts, options...)
 }
 
 // NewCounterVec works like the function of the same name in the metrics
@@ -59,12 +65,22 @@ func NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
 // prometheus.DefaultRegisterer. If the registration fails, NewCounterVec
 // panics.
 //
-// It used the default options DefaultOptions
-func NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *metrics.MetricVec[prometheus.Counter] {
-	return With(prometheus.DefaultRegisterer).NewCounterVec(opts, labelNames)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewCounterVec(opts prometheus.CounterOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Counter] {
+	return With(prometheus.DefaultRegisterer).NewCounterVec(opts, labelNames, options...)
 }
 
-// NewGauge works like the function of the same name in the prometheus package
+// NewCounterFunc works like the function of the same name in the metrics
+// package but it automatically registers the CounterFunc with the
+// prometheus.DefaultRegisterer. If the registration fails, NewCounterFunc
+// panics.
+//
+// It used the default options DefaultOptions, overridden by the given options.
+func NewCounterFunc(opts prometheus.CounterOpts, function func() float64, options ...Option) prometheus.CounterFunc {
+	return With(prometheus.DefaultRegisterer).NewCounterFunc(opts, function, options...)
+}
+
+// NewGauge works like the function of the same name in the metrics package
 // but it automatically registers the Gauge with the
 // prometheus.DefaultRegisterer. If the registration fails, NewGauge panics.
 func NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
@@ -75,18 +91,48 @@ func NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
 // package but it automatically registers the GaugeVec with the
 // prometheus.DefaultRegisterer. If the registration fails, NewGaugeVec panics.
 //
-// It used the default options DefaultOptions
-func NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *metrics.MetricVec[prometheus.Gauge] {
-	return With(prometheus.DefaultRegisterer).NewGaugeVec(opts, labelNames)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Gauge] {
+	return With(prometheus.DefaultRegisterer).NewGaugeVec(opts, labelNames, options...)
+}
+
+// NewGaugeFunc works like the function of the same name in the metrics
+// package but it automatically registers the GaugeFunc with the
+// prometheus.DefaultRegisterer. If the registration fails, NewGaugeFunc
+// panics.
+//
+// It used the default options DefaultOptions, overridden by the given options.
+func NewGaugeFunc(opts prometheus.GaugeOpts, function func() float64, options ...Option) prometheus.GaugeFunc {
+	return With(prometheus.DefaultRegisterer).NewGaugeFunc(opts, function, options...)
+}
+
+// NewUntypedFunc works like the function of the same name in the metrics
+// package but it automatically registers the UntypedFunc with the
+// prometheus.DefaultRegisterer. If the registration fails, NewUntypedFunc
+// panics.
+//
+// It used the default options DefaultOptions, overridden by the given options.
+func NewUntypedFunc(opts prometheus.UntypedOpts, function func() float64, options ...Option) prometheus.UntypedFunc {
+	return With(prometheus.DefaultRegisterer).NewUntypedFunc(opts, function, options...)
+}
+
+// NewUntypedVec works like the function of the same name in the metrics
+// package but it automatically registers the UntypedVec with the
+// prometheus.DefaultRegisterer. If the registration fails, NewUntypedVec
+// panics.
+//
+// It used the default options DefaultOptions, overridden by the given options.
+func NewUntypedVec(opts prometheus.UntypedOpts, labelNames []string, options ...Option) *metrics.MetricVec[metrics.Untyped] {
+	return With(prometheus.DefaultRegisterer).NewUntypedVec(opts, labelNames, options...)
 }
 
 // NewSummary works like the function of the same name in the metrics package
 // but it automatically registers the Summary with the
 // prometheus.DefaultRegisterer. If the registration fails, NewSummary panics.
 //
-// It used the default options DefaultOptions
-func NewSummary(opts prometheus.SummaryOpts) prometheus.Summary {
-	return With(prometheus.DefaultRegisterer).NewSummary(opts)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewSummary(opts prometheus.SummaryOpts, options ...Option) prometheus.Summary {
+	return With(prometheus.DefaultRegisterer).NewSummary(opts, options...)
 }
 
 // NewSummaryVec works like the function of the same name in the metrics
@@ -94,18 +140,18 @@ func NewSummary(opts prometheus.SummaryOpts) prometheus.Summary {
 // prometheus.DefaultRegisterer. If the registration fails, NewSummaryVec
 // panics.
 //
-// It used the default options DefaultOptions
-func NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string) *metrics.MetricVec[prometheus.Summary] {
-	return With(prometheus.DefaultRegisterer).NewSummaryVec(opts, labelNames)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Summary] {
+	return With(prometheus.DefaultRegisterer).NewSummaryVec(opts, labelNames, options...)
 }
 
 // NewHistogram works like the function of the same name in the metrics
 // package but it automatically registers the Histogram with the
 // prometheus.DefaultRegisterer. If the registration fails, NewHistogram panics.
 //
-// It used the default options DefaultOptions
-func NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
-	return With(prometheus.DefaultRegisterer).NewHistogram(opts)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewHistogram(opts prometheus.HistogramOpts, options ...Option) prometheus.Histogram {
+	return With(prometheus.DefaultRegisterer).NewHistogram(opts, options...)
 }
 
 // NewHistogramVec works like the function of the same name in the metrics
@@ -113,9 +159,9 @@ func NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
 // prometheus.DefaultRegisterer. If the registration fails, NewHistogramVec
 // panics.
 //
-// It used the default options DefaultOptions
-func NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *metrics.MetricVec[prometheus.Histogram] {
-	return With(prometheus.DefaultRegisterer).NewHistogramVec(opts, labelNames)
+// It used the default options DefaultOptions, overridden by the given options.
+func NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Histogram] {
+	return With(prometheus.DefaultRegisterer).NewHistogramVec(opts, labelNames, options...)
 }
 
 // Factory provides factory methods to create Collectors that are automatically
@@ -127,15 +173,28 @@ func NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *metric
 // It uses the DefaultOptions as configuration for the created metrics collectors.
 // Additionally you can use the WithOptions function to provides your own options instead
 // of the default ones.
+//
+// Derived factories (see WithPrefix, WithConstLabels and Sub) name the created metrics differently, but keep the
+// options, the Catalogue and the Config of the Factory.
 type Factory struct {
-	r    prometheus.Registerer
-	opts SmartMetricOpts
+	r         prometheus.Registerer
+	opts      SmartMetricOpts
+	catalogue *Catalogue
+	config    *Config
+	// naming of the created metrics, see WithPrefix, WithConstLabels and Sub
+	prefix      string
+	subsystem   string
+	constLabels prometheus.Labels
 }
 
 // With creates a Factory using the provided Registerer for registration of the
 // created Collectors. If the provided Registerer is nil, the returned Factory
 // creates Collectors that are not registered with any Registerer.
-func With(r prometheus.Registerer) Factory { return Factory{r, DefaultOptions} }
+//
+// The created Collectors are tracked by the DefaultCatalogue if set, and configured by the DefaultConfig if set.
+func With(r prometheus.Registerer) Factory {
+	return Factory{r: r, opts: DefaultOptions, catalogue: DefaultCatalogue, config: DefaultConfig}
+}
 
 // WithOptions creates a Factory using SmartMetricOpts to creates new metrics and that registers
 // the created Collectors to the given Registerer.
@@ -144,89 +203,334 @@ func With(r prometheus.Registerer) Factory { return Factory{r, DefaultOptions} }
 // creates Collectors that are not registered with any Registerer.
 //
 // The returned Factory creates the new collector with the configurations provided by opts.
-func WithOptions(r prometheus.Registerer, opts SmartMetricOpts) Factory { return Factory{r, opts} }
+func WithOptions(r prometheus.Registerer, opts SmartMetricOpts) Factory {
+	return Factory{r: r, opts: opts, catalogue: DefaultCatalogue, config: DefaultConfig}
+}
+
+// WithCatalogue returns a copy of the Factory whose created Collectors are tracked by the given Catalogue
+// (no Catalogue when nil).
+func (f Factory) WithCatalogue(c *Catalogue) Factory {
+	f.catalogue = c
+	return f
+}
+
+// WithConfig returns a copy of the Factory whose created metrics are configured by the given Config
+// (no Config when nil): the options of the Config matching the name of a metric override the options of the Factory.
+func (f Factory) WithConfig(c *Config) Factory {
+	f.config = c
+	return f
+}
+
+// WithPrefix returns a copy of the Factory whose created metrics have their fully-qualified name prefixed with the
+// given prefix (e.g. "mylib_"), like the metrics registered with a registerer wrapped by
+// prometheus.WrapRegistererWithPrefix. The prefixes of successive calls are concatenated in order.
+func (f Factory) WithPrefix(prefix string) Factory {
+	f.prefix += prefix
+	return f
+}
+
+// WithConstLabels returns a copy of the Factory whose created metrics have the given constant labels in addition to
+// their own ones, like the metrics registered with a registerer wrapped by prometheus.WrapRegistererWith.
+// The Factory panics when creating a metric having one of these labels.
+func (f Factory) WithConstLabels(labels prometheus.Labels) Factory {
+	constLabels := make(prometheus.Labels, len(f.constLabels)+len(labels))
+	for name, value := range f.constLabels {
+		constLabels[name] = value
+	}
+	for name, value := range labels {
+		constLabels[name] = value
+	}
+	f.constLabels = constLabels
+	return f
+}
+
+// Sub returns a copy of the Factory whose created metrics belong to the given subsystem: it is inserted in their
+// fully-qualified name between their namespace and their own subsystem, if any (e.g. myapp_pool_connections).
+func (f Factory) Sub(subsystem string) Factory {
+	f.subsystem = joinName(f.subsystem, subsystem)
+	return f
+}
 
-// NewCounter works like the function of the same name in the metrics package
-// but it automatically registers the Counter with the Factory's Registerer.
-func (f Factory) NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
-	c := metrics.NewCounter(metrics.CounterOpts{CounterOpts: opts, WarmUpDuration: f.opts.WarmUpDuration, ExpirationDelay: f.opts.ExpirationDelay})
+func joinName(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "_" + b
+}
+
+// qualify applies the prefix, subsystem and constant labels of the Factory to the options of a metric,
+// and returns its fully-qualified name.
+func (f Factory) qualify(namespace, subsystem, name *string, constLabels *prometheus.Labels) string {
+	if f.subsystem != "" {
+		*subsystem = joinName(f.subsystem, *subsystem)
+	}
+	fqName := prometheus.BuildFQName(*namespace, *subsystem, *name)
+	if f.prefix != "" {
+		fqName = f.prefix + fqName
+		*namespace, *subsystem, *name = "", "", fqName
+	}
+	if len(f.constLabels) > 0 {
+		labels := make(prometheus.Labels, len(*constLabels)+len(f.constLabels))
+		for name, value := range *constLabels {
+			labels[name] = value
+		}
+		for name, value := range f.constLabels {
+			if _, found := labels[name]; found {
+				panic(fmt.Errorf("metric %s already has the constant label %q of the factory", fqName, name))
+			}
+			labels[name] = value
+		}
+		*constLabels = labels
+	}
+	return fqName
+}
+
+// optsWith returns the options of the Factory overridden by the given options.
+func (f Factory) optsWith(options []Option) SmartMetricOpts {
+	opts := f.opts
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// configure overrides the given options of the metric of the given fully-qualified name with the options of the
+// Config of the Factory. warmUpDuration is nil for the metrics without warm-up.
+func (f Factory) configure(name string, warmUpDuration, expirationDelay *time.Duration, vectorOpts *metrics.VectorOpts) {
+	if f.config == nil {
+		return
+	}
+	opts := SmartMetricOpts{ExpirationDelay: *expirationDelay, VectorOpts: *vectorOpts}
+	if warmUpDuration != nil {
+		opts.WarmUpDuration = *warmUpDuration
+	}
+	opts = f.config.apply(name, opts)
+	if warmUpDuration != nil {
+		*warmUpDuration = opts.WarmUpDuration
+	}
+	*expirationDelay = opts.ExpirationDelay
+	*vectorOpts = opts.VectorOpts
+}
+
+// register registers the created Collector with the Factory's Registerer and adds it to the Factory's Catalogue.
+// vector is nil for single metrics.
+func (f Factory) register(name string, constLabels prometheus.Labels, c prometheus.Collector, vector metrics.Vector) {
 	if f.r != nil {
 		f.r.MustRegister(c)
 	}
+	if f.catalogue != nil {
+		entry := CatalogueEntry{Name: name, ID: metrics.ID(name, constLabels), Collector: c, Vector: vector, registerer: f.r}
+		f.catalogue.add(entry)
+	}
+}
+
+// NewCounter works like the function of the same name in the metrics
+// package but it automatically registers the Counter with the Factory's
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewCounter(opts prometheus.CounterOpts, options ...Option) prometheus.Counter {
+	o := f.optsWith(options)
+	return f.NewCounterWithOpts(metrics.CounterOpts{CounterOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock})
+}
+
+// NewCounterWithOpts works like NewCounter but it creates the Counter with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewCounterWithOpts(opts metrics.CounterOpts) prometheus.Counter {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	c := metrics.NewCounter(opts)
+	f.register(name, opts.ConstLabels, c, nil)
 	return c
 }
 
 // NewCounterVec works like the function of the same name in the metrics
 // package but it automatically registers the CounterVec with the Factory's
-// Registerer.
-func (f Factory) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *metrics.MetricVec[prometheus.Counter] {
-	c := metrics.NewCounterVec(metrics.CounterOpts{CounterOpts: opts, WarmUpDuration: f.opts.WarmUpDuration, ExpirationDelay: f.opts.ExpirationDelay}, labelNames)
-	if f.r != nil {
-		f.r.MustRegister(c)
-	}
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewCounterVec(opts prometheus.CounterOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Counter] {
+	o := f.optsWith(options)
+	return f.NewCounterVecWithOpts(metrics.CounterOpts{CounterOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock, VectorOpts: o.VectorOpts}, labelNames)
+}
+
+// NewCounterVecWithOpts works like NewCounterVec but it creates the CounterVec with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewCounterVecWithOpts(opts metrics.CounterOpts, labelNames []string) *metrics.MetricVec[prometheus.Counter] {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	c := metrics.NewCounterVec(opts, labelNames)
+	f.register(name, opts.ConstLabels, c, c)
 	return c
 }
 
-// NewGauge works like the function of the same name in the prometheus package
+// NewCounterFunc works like the function of the same name in the metrics
+// package but it automatically registers the CounterFunc with the Factory's
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewCounterFunc(opts prometheus.CounterOpts, function func() float64, options ...Option) prometheus.CounterFunc {
+	o := f.optsWith(options)
+	return f.NewCounterFuncWithOpts(metrics.CounterOpts{CounterOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock}, function)
+}
+
+// NewCounterFuncWithOpts works like NewCounterFunc but it creates the CounterFunc with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewCounterFuncWithOpts(opts metrics.CounterOpts, function func() float64) prometheus.CounterFunc {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	c := metrics.NewCounterFunc(opts, function)
+	f.register(name, opts.ConstLabels, c, nil)
+	return c
+}
+
+// NewGauge works like the function of the same name in the metrics package
 // but it automatically registers the Gauge with the Factory's Registerer.
+// No option applies to single gauges.
 func (f Factory) NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
-	g := prometheus.NewGauge(opts)
-	if f.r != nil {
-		f.r.MustRegister(g)
-	}
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	g := metrics.NewGauge(metrics.GaugeOpts{GaugeOpts: opts})
+	f.register(name, opts.ConstLabels, g, nil)
 	return g
 }
 
 // NewGaugeVec works like the function of the same name in the metrics
 // package but it automatically registers the GaugeVec with the Factory's
-// Registerer.
-func (f Factory) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *metrics.MetricVec[prometheus.Gauge] {
-	g := metrics.NewGaugeVec(metrics.GaugeOpts{GaugeOpts: opts, ExpirationDelay: f.opts.ExpirationDelay}, labelNames)
-	if f.r != nil {
-		f.r.MustRegister(g)
-	}
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Gauge] {
+	o := f.optsWith(options)
+	return f.NewGaugeVecWithOpts(metrics.GaugeOpts{GaugeOpts: opts, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock, VectorOpts: o.VectorOpts}, labelNames)
+}
+
+// NewGaugeVecWithOpts works like NewGaugeVec but it creates the GaugeVec with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewGaugeVecWithOpts(opts metrics.GaugeOpts, labelNames []string) *metrics.MetricVec[prometheus.Gauge] {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, nil, &opts.ExpirationDelay, &opts.VectorOpts)
+	g := metrics.NewGaugeVec(opts, labelNames)
+	f.register(name, opts.ConstLabels, g, g)
 	return g
 }
 
-// NewSummary works like the function of the same name in the metrics package
-// but it automatically registers the Summary with the Factory's Registerer.
-func (f Factory) NewSummary(opts prometheus.SummaryOpts) prometheus.Summary {
-	s := metrics.NewSummary(metrics.SummaryOpts{SummaryOpts: opts, WarmUpDuration: f.opts.WarmUpDuration, ExpirationDelay: f.opts.ExpirationDelay})
-	if f.r != nil {
-		f.r.MustRegister(s)
-	}
+// NewGaugeFunc works like the function of the same name in the metrics
+// package but it automatically registers the GaugeFunc with the Factory's
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewGaugeFunc(opts prometheus.GaugeOpts, function func() float64, options ...Option) prometheus.GaugeFunc {
+	o := f.optsWith(options)
+	return f.NewGaugeFuncWithOpts(metrics.GaugeOpts{GaugeOpts: opts, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock}, function)
+}
+
+// NewGaugeFuncWithOpts works like NewGaugeFunc but it creates the GaugeFunc with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewGaugeFuncWithOpts(opts metrics.GaugeOpts, function func() float64) prometheus.GaugeFunc {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, nil, &opts.ExpirationDelay, &opts.VectorOpts)
+	g := metrics.NewGaugeFunc(opts, function)
+	f.register(name, opts.ConstLabels, g, nil)
+	return g
+}
+
+// NewUntypedFunc works like the function of the same name in the metrics
+// package but it automatically registers the UntypedFunc with the Factory's
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewUntypedFunc(opts prometheus.UntypedOpts, function func() float64, options ...Option) prometheus.UntypedFunc {
+	o := f.optsWith(options)
+	return f.NewUntypedFuncWithOpts(metrics.UntypedOpts{UntypedOpts: opts, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock}, function)
+}
+
+// NewUntypedFuncWithOpts works like NewUntypedFunc but it creates the UntypedFunc with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewUntypedFuncWithOpts(opts metrics.UntypedOpts, function func() float64) prometheus.UntypedFunc {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, nil, &opts.ExpirationDelay, &opts.VectorOpts)
+	u := metrics.NewUntypedFunc(opts, function)
+	f.register(name, opts.ConstLabels, u, nil)
+	return u
+}
+
+// NewUntypedVec works like the function of the same name in the metrics
+// package but it automatically registers the UntypedVec with the Factory's
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewUntypedVec(opts prometheus.UntypedOpts, labelNames []string, options ...Option) *metrics.MetricVec[metrics.Untyped] {
+	o := f.optsWith(options)
+	return f.NewUntypedVecWithOpts(metrics.UntypedOpts{UntypedOpts: opts, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock, VectorOpts: o.VectorOpts}, labelNames)
+}
+
+// NewUntypedVecWithOpts works like NewUntypedVec but it creates the UntypedVec with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewUntypedVecWithOpts(opts metrics.UntypedOpts, labelNames []string) *metrics.MetricVec[metrics.Untyped] {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, nil, &opts.ExpirationDelay, &opts.VectorOpts)
+	u := metrics.NewUntypedVec(opts, labelNames)
+	f.register(name, opts.ConstLabels, u, u)
+	return u
+}
+
+// NewSummary works like the function of the same name in the metrics
+// package but it automatically registers the Summary with the Factory's
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewSummary(opts prometheus.SummaryOpts, options ...Option) prometheus.Summary {
+	o := f.optsWith(options)
+	return f.NewSummaryWithOpts(metrics.SummaryOpts{SummaryOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock})
+}
+
+// NewSummaryWithOpts works like NewSummary but it creates the Summary with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewSummaryWithOpts(opts metrics.SummaryOpts) prometheus.Summary {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	s := metrics.NewSummary(opts)
+	f.register(name, opts.ConstLabels, s, nil)
 	return s
 }
 
 // NewSummaryVec works like the function of the same name in the metrics
 // package but it automatically registers the SummaryVec with the Factory's
-// Registerer.
-func (f Factory) NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string) *metrics.MetricVec[prometheus.Summary] {
-	s := metrics.NewSummaryVec(metrics.SummaryOpts{SummaryOpts: opts, WarmUpDuration: f.opts.WarmUpDuration, ExpirationDelay: f.opts.ExpirationDelay}, labelNames)
-	if f.r != nil {
-		f.r.MustRegister(s)
-	}
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Summary] {
+	o := f.optsWith(options)
+	return f.NewSummaryVecWithOpts(metrics.SummaryOpts{SummaryOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock, VectorOpts: o.VectorOpts}, labelNames)
+}
+
+// NewSummaryVecWithOpts works like NewSummaryVec but it creates the SummaryVec with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewSummaryVecWithOpts(opts metrics.SummaryOpts, labelNames []string) *metrics.MetricVec[prometheus.Summary] {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	s := metrics.NewSummaryVec(opts, labelNames)
+	f.register(name, opts.ConstLabels, s, s)
 	return s
 }
 
 // NewHistogram works like the function of the same name in the metrics
 // package but it automatically registers the Histogram with the Factory's
-// Registerer.
-func (f Factory) NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
-	h := metrics.NewHistogram(metrics.HistogramOpts{HistogramOpts: opts, WarmUpDuration: f.opts.WarmUpDuration, ExpirationDelay: f.opts.ExpirationDelay})
-	if f.r != nil {
-		f.r.MustRegister(h)
-	}
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewHistogram(opts prometheus.HistogramOpts, options ...Option) prometheus.Histogram {
+	o := f.optsWith(options)
+	return f.NewHistogramWithOpts(metrics.HistogramOpts{HistogramOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock})
+}
+
+// NewHistogramWithOpts works like NewHistogram but it creates the Histogram with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewHistogramWithOpts(opts metrics.HistogramOpts) prometheus.Histogram {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	h := metrics.NewHistogram(opts)
+	f.register(name, opts.ConstLabels, h, nil)
 	return h
 }
 
 // NewHistogramVec works like the function of the same name in the metrics
 // package but it automatically registers the HistogramVec with the Factory's
-// Registerer.
-func (f Factory) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *metrics.MetricVec[prometheus.Histogram] {
-	h := metrics.NewHistogramVec(metrics.HistogramOpts{HistogramOpts: opts, WarmUpDuration: f.opts.WarmUpDuration, ExpirationDelay: f.opts.ExpirationDelay}, labelNames)
-	if f.r != nil {
-		f.r.MustRegister(h)
-	}
+// Registerer. The given options override the options of the Factory.
+func (f Factory) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string, options ...Option) *metrics.MetricVec[prometheus.Histogram] {
+	o := f.optsWith(options)
+	return f.NewHistogramVecWithOpts(metrics.HistogramOpts{HistogramOpts: opts, WarmUpDuration: o.WarmUpDuration, ExpirationDelay: o.ExpirationDelay, Clock: o.Clock, VectorOpts: o.VectorOpts}, labelNames)
+}
+
+// NewHistogramVecWithOpts works like NewHistogramVec but it creates the HistogramVec with the given
+// options instead of the options of the Factory. The Config of the Factory still applies.
+func (f Factory) NewHistogramVecWithOpts(opts metrics.HistogramOpts, labelNames []string) *metrics.MetricVec[prometheus.Histogram] {
+	name := f.qualify(&opts.Namespace, &opts.Subsystem, &opts.Name, &opts.ConstLabels)
+	f.configure(name, &opts.WarmUpDuration, &opts.ExpirationDelay, &opts.VectorOpts)
+	h := metrics.NewHistogramVec(opts, labelNames)
+	f.register(name, opts.ConstLabels, h, h)
 	return h
 }
@@ -0,0 +1,85 @@
+package promauto
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactory_FuncsAndUntyped(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	catalogue := NewCatalogue()
+	factory := WithOptions(registry, SmartMetricOpts{}).WithCatalogue(catalogue)
+
+	factory.NewCounterFunc(prometheus.CounterOpts{Name: "connections_total", Help: "Help message"}, func() float64 { return 3 })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{Name: "queue_size", Help: "Help message"}, func() float64 { return 2 })
+	factory.NewUntypedFunc(prometheus.UntypedOpts{Name: "external", Help: "Help message"}, func() float64 { return 1 })
+	untypedVec := factory.NewUntypedVec(prometheus.UntypedOpts{Name: "external_by_source", Help: "Help message"}, []string{"source"})
+	untypedVec.WithLabelValues("a").Set(4)
+
+	for _, name := range []string{"connections_total", "queue_size", "external", "external_by_source"} {
+		assert.Equal(t, 1, gatherCount(t, registry, name), name)
+	}
+	assert.Len(t, catalogue.Entries(), 4)
+	entry, found := catalogue.Lookup("external_by_source")
+	require.True(t, found)
+	assert.Equal(t, metrics.Vector(untypedVec), entry.Vector)
+
+	// the Func variants can be disabled like the other metrics
+	assert.True(t, catalogue.SetEnabled("connections_total", false))
+	assert.Equal(t, 0, gatherCount(t, registry, "connections_total"))
+}
+
+func TestFactory_PrefixAndConstLabels(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	catalogue := NewCatalogue()
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	factory := WithOptions(registry, SmartMetricOpts{WarmUpDuration: 10 * time.Second, Clock: clock}).
+		WithCatalogue(catalogue).
+		WithPrefix("mylib_").
+		WithConstLabels(prometheus.Labels{"component": "cache"})
+
+	requests := factory.Sub("http").NewCounterVec(prometheus.CounterOpts{Namespace: "app", Name: "requests_total", Help: "Help message"}, []string{"code"})
+	size := factory.NewGauge(prometheus.GaugeOpts{Name: "size", Help: "Help message", ConstLabels: prometheus.Labels{"shard": "1"}})
+	requests.WithLabelValues("200").Inc()
+	size.Set(3)
+
+	expect := `
+		# HELP mylib_app_http_requests_total Help message
+		# TYPE mylib_app_http_requests_total counter
+		mylib_app_http_requests_total{_tag_="48ab9774",code="200",component="cache"} 0
+		# HELP mylib_size Help message
+		# TYPE mylib_size gauge
+		mylib_size{component="cache",shard="1"} 3
+		`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expect)))
+
+	// the warm-up still applies
+	clock.Advance(11 * time.Second)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(strings.Replace(expect, "} 0", "} 1", 1))))
+
+	entry, found := catalogue.Lookup(`mylib_app_http_requests_total{component="cache"}`)
+	assert.True(t, found)
+	assert.Equal(t, "mylib_app_http_requests_total", entry.Name)
+	assert.Equal(t, "mylib_app_http_requests_total", requests.Name())
+	assert.Equal(t, `mylib_app_http_requests_total{component="cache"}`, requests.ID())
+
+	assert.Panics(t, func() {
+		factory.NewCounter(prometheus.CounterOpts{Name: "events_total", Help: "Help message", ConstLabels: prometheus.Labels{"component": "other"}})
+	})
+}
+
+func TestFactory_Sub(t *testing.T) {
+	factory := With(nil).Sub("pool").Sub("conn")
+	counter := factory.NewCounterVec(prometheus.CounterOpts{Namespace: "app", Subsystem: "tcp", Name: "opened_total", Help: "Help message"}, []string{"host"})
+	assert.Equal(t, "app_pool_conn_tcp_opened_total", counter.Name())
+	gauge := factory.NewGaugeVec(prometheus.GaugeOpts{Name: "size", Help: "Help message"}, []string{"host"})
+	assert.Equal(t, "pool_conn_size", gauge.Name())
+}
@@ -0,0 +1,195 @@
+package promauto
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultCatalogue is the Catalogue of the Factories created by With and WithOptions, and thus of the package level
+// NewXXX functions. No Catalogue is used when nil (default).
+var DefaultCatalogue *Catalogue
+
+// CatalogueEntry is a Collector created by a Factory attached to a Catalogue.
+type CatalogueEntry struct {
+	// Name is the fully-qualified name of the metric.
+	Name string
+	// ID identifies the entry in the Catalogue: the fully-qualified name of the metric followed by its constant labels
+	// if any (see metrics.ID).
+	ID string
+	// Collector is the created metric or vector of metrics.
+	Collector prometheus.Collector
+	// Vector is the created vector of metrics, nil for a single metric.
+	Vector metrics.Vector
+	// registerer the Collector is registered with, nil if none
+	registerer prometheus.Registerer
+}
+
+// Catalogue tracks the metrics and vectors of metrics created by the Factories it is attached to (see
+// Factory.WithCatalogue and DefaultCatalogue), so that operations can be applied to all of them, e.g. changing their
+// options at runtime with SetWarmUpDuration or SetExpirationDelay.
+// The entries are identified by the fully-qualified name and the constant labels of their metric (see
+// CatalogueEntry.ID), so that the metrics of the same name created by Factories with different constant labels are
+// all tracked: an entry replaces the previous entry of the same ID.
+type Catalogue struct {
+	mutex   sync.RWMutex
+	entries map[string]CatalogueEntry
+	// names of the disabled metrics, including the ones not created yet, see SetEnabled
+	disabled map[string]bool
+	// names of the metrics disabled by the last list given to SetDisabled
+	listed map[string]bool
+}
+
+// NewCatalogue creates a new empty Catalogue.
+func NewCatalogue() *Catalogue {
+	return &Catalogue{entries: make(map[string]CatalogueEntry), disabled: make(map[string]bool), listed: make(map[string]bool)}
+}
+
+func (c *Catalogue) add(entry CatalogueEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[entry.ID] = entry
+	if c.isDisabled(entry.Name) || c.isDisabled(entry.ID) {
+		setEnabled(entry, false)
+	}
+}
+
+// Entries returns the entries of the Catalogue sorted by name, then by ID.
+func (c *Catalogue) Entries() []CatalogueEntry {
+	c.mutex.RLock()
+	entries := make([]CatalogueEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	c.mutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Vectors returns the vectors of metrics of the Catalogue sorted by name, then by ID.
+func (c *Catalogue) Vectors() []metrics.Vector {
+	var vectors []metrics.Vector
+	for _, entry := range c.Entries() {
+		if entry.Vector != nil {
+			vectors = append(vectors, entry.Vector)
+		}
+	}
+	return vectors
+}
+
+// Lookup returns the entry of the given ID, i.e. the fully-qualified name for the metrics without constant labels.
+func (c *Catalogue) Lookup(id string) (CatalogueEntry, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	entry, found := c.entries[id]
+	return entry, found
+}
+
+// Unregister unregisters the Collector of the given ID (see Lookup) from the Registerer of the Factory that created it, and removes it from the Catalogue. A vector is also detached from its Budget, StatsCollector and
+// Observer (see metrics.MetricVec.Detach), giving back its series to the Budget.
+// It returns false if the Catalogue has no such entry.
+func (c *Catalogue) Unregister(id string) bool {
+	c.mutex.Lock()
+	entry, found := c.entries[id]
+	delete(c.entries, id)
+	c.mutex.Unlock()
+	if !found {
+		return false
+	}
+	if entry.registerer != nil {
+		entry.registerer.Unregister(entry.Collector)
+	}
+	if entry.Vector != nil {
+		entry.Vector.Detach()
+	}
+	return true
+}
+
+// DeletionReport is the result of DeleteEverywhere: the label values of the deleted series, by ID of the vectors
+// having the given labels (a vector without deleted series has an empty entry).
+type DeletionReport map[string][][]string
+
+// DeleteEverywhere deletes the series matching the given labels from all the vectors of the Catalogue having these
+// labels (see metrics.MetricVec.DeletePartialMatch), e.g. to stop exporting the series of an offboarded tenant.
+// When quarantine is greater than zero, the matching series cannot be created again during this duration (see
+// metrics.MetricVec.Quarantine).
+func (c *Catalogue) DeleteEverywhere(labels prometheus.Labels, quarantine time.Duration) DeletionReport {
+	report := DeletionReport{}
+	for _, vector := range c.Vectors() {
+		if !hasLabels(vector, labels) {
+			continue
+		}
+		// quarantine first so that the deleted series cannot be created again meanwhile
+		if quarantine > 0 {
+			vector.Quarantine(labels, quarantine)
+		}
+		deleted := vector.DeletePartialMatchLabelValues(labels)
+		if deleted == nil {
+			deleted = [][]string{}
+		}
+		report[vector.ID()] = deleted
+	}
+	return report
+}
+
+// DeleteEverywhere works like Catalogue.DeleteEverywhere with the DefaultCatalogue.
+// It deletes nothing when there is no DefaultCatalogue.
+func DeleteEverywhere(labels prometheus.Labels, quarantine time.Duration) DeletionReport {
+	if DefaultCatalogue == nil {
+		return DeletionReport{}
+	}
+	return DefaultCatalogue.DeleteEverywhere(labels, quarantine)
+}
+
+func hasLabels(vector metrics.Vector, labels prometheus.Labels) bool {
+	names := vector.LabelNames()
+	for name := range labels {
+		found := false
+		for _, labelName := range names {
+			found = found || labelName == name
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SetWarmUpDuration changes the warm-up duration of all the metrics and vectors of the Catalogue supporting it
+// (see metrics.WarmUpSetter).
+func (c *Catalogue) SetWarmUpDuration(d time.Duration) {
+	for _, entry := range c.Entries() {
+		if setter, ok := entry.Collector.(metrics.WarmUpSetter); ok {
+			setter.SetWarmUpDuration(d)
+		}
+	}
+}
+
+// SetExpirationDelay changes the expiration delay of all the vectors of the Catalogue.
+func (c *Catalogue) SetExpirationDelay(d time.Duration) {
+	for _, vector := range c.Vectors() {
+		vector.SetExpirationDelay(d)
+	}
+}
+
+// SetMaxSeries changes the maximum number of series of all the vectors of the Catalogue.
+func (c *Catalogue) SetMaxSeries(maxSeries int) {
+	for _, vector := range c.Vectors() {
+		vector.SetMaxSeries(maxSeries)
+	}
+}
+
+// SetLimitPolicy changes the limit policy of all the vectors of the Catalogue.
+func (c *Catalogue) SetLimitPolicy(policy metrics.LimitPolicy) {
+	for _, vector := range c.Vectors() {
+		vector.SetLimitPolicy(policy)
+	}
+}
@@ -0,0 +1,160 @@
+package promauto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogue(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	catalogue := NewCatalogue()
+	factory := WithOptions(registry, SmartMetricOpts{}).WithCatalogue(catalogue)
+
+	counterVec := factory.NewCounterVec(prometheus.CounterOpts{Namespace: "app", Name: "requests_total", Help: "Help message"}, []string{"code"})
+	gauge := factory.NewGauge(prometheus.GaugeOpts{Namespace: "app", Subsystem: "pool", Name: "size", Help: "Help message"})
+	With(nil).NewCounter(prometheus.CounterOpts{Name: "untracked", Help: "Help message"})
+
+	entries := catalogue.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "app_pool_size", entries[0].Name)
+	assert.Equal(t, gauge, entries[0].Collector)
+	assert.Nil(t, entries[0].Vector)
+	assert.Equal(t, "app_requests_total", entries[1].Name)
+	assert.Equal(t, counterVec, entries[1].Vector)
+
+	vectors := catalogue.Vectors()
+	require.Len(t, vectors, 1)
+	assert.Equal(t, "app_requests_total", vectors[0].Name())
+
+	entry, found := catalogue.Lookup("app_requests_total")
+	assert.True(t, found)
+	assert.Equal(t, counterVec, entry.Collector)
+	_, found = catalogue.Lookup("untracked")
+	assert.False(t, found)
+
+	counterVec.WithLabelValues("200").Inc()
+	assert.Equal(t, 1, gatherCount(t, registry, "app_requests_total"))
+	assert.True(t, catalogue.Unregister("app_requests_total"))
+	assert.False(t, catalogue.Unregister("app_requests_total"))
+	assert.Equal(t, 0, gatherCount(t, registry, "app_requests_total"))
+	assert.Len(t, catalogue.Entries(), 1)
+}
+
+func TestCatalogue_UnregisterDetachesVectors(t *testing.T) {
+	budget := metrics.NewBudget(10, metrics.LimitReject)
+	stats := metrics.NewStatsCollector()
+	catalogue := NewCatalogue()
+	factory := WithOptions(nil, SmartMetricOpts{VectorOpts: metrics.VectorOpts{Budget: budget, Stats: stats}}).WithCatalogue(catalogue)
+	requests := factory.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Help message"}, []string{"code"})
+	factory.NewGaugeVec(prometheus.GaugeOpts{Name: "sessions", Help: "Help message"}, []string{"tenant"})
+	requests.WithLabelValues("200").Inc()
+	requests.WithLabelValues("500").Inc()
+	assert.Equal(t, 2, budget.Used())
+	assert.Equal(t, 2, testutil.CollectAndCount(stats, "smart_vector_lifecycles_created_total"))
+
+	assert.True(t, catalogue.Unregister("requests_total"))
+	assert.Equal(t, 0, budget.Used())
+	assert.Equal(t, 1, testutil.CollectAndCount(stats, "smart_vector_lifecycles_created_total"))
+}
+
+func TestCatalogue_SameNameWithDifferentConstLabels(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	stats := metrics.NewStatsCollector()
+	registry.MustRegister(stats)
+	catalogue := NewCatalogue()
+	factory := WithOptions(registry, SmartMetricOpts{VectorOpts: metrics.VectorOpts{Stats: stats}}).WithCatalogue(catalogue)
+	opts := prometheus.CounterOpts{Name: "requests_total", Help: "Help message"}
+	a := factory.WithConstLabels(prometheus.Labels{"component": "a"}).NewCounterVec(opts, []string{"tenant"})
+	b := factory.WithConstLabels(prometheus.Labels{"component": "b"}).NewCounterVec(opts, []string{"tenant"})
+	a.WithLabelValues("acme").Inc()
+	b.WithLabelValues("acme").Inc()
+
+	entries := catalogue.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, `requests_total{component="a"}`, entries[0].ID)
+	assert.Equal(t, `requests_total{component="b"}`, entries[1].ID)
+	_, err := registry.Gather()
+	assert.NoError(t, err)
+
+	report := catalogue.DeleteEverywhere(prometheus.Labels{"tenant": "acme"}, 0)
+	assert.Equal(t, DeletionReport{
+		`requests_total{component="a"}`: {{"acme"}},
+		`requests_total{component="b"}`: {{"acme"}},
+	}, report)
+
+	// the name disables all the metrics of this name
+	assert.True(t, catalogue.SetEnabled("requests_total", false))
+	assert.False(t, a.Enabled())
+	assert.False(t, b.Enabled())
+	assert.True(t, catalogue.SetEnabled("requests_total", true))
+	assert.True(t, catalogue.SetEnabled(`requests_total{component="b"}`, false))
+	assert.True(t, a.Enabled())
+	assert.False(t, b.Enabled())
+
+	assert.True(t, catalogue.Unregister(`requests_total{component="a"}`))
+	require.Len(t, catalogue.Entries(), 1)
+	assert.Equal(t, b, catalogue.Entries()[0].Vector)
+}
+
+func gatherCount(t *testing.T, registry *prometheus.Registry, name string) int {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return len(family.GetMetric())
+		}
+	}
+	return 0
+}
+
+func TestCatalogue_DeleteEverywhere(t *testing.T) {
+	catalogue := NewCatalogue()
+	factory := WithOptions(nil, SmartMetricOpts{}).WithCatalogue(catalogue)
+	requests := factory.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Help message"}, []string{"tenant", "code"})
+	sessions := factory.NewGaugeVec(prometheus.GaugeOpts{Name: "sessions", Help: "Help message"}, []string{"tenant"})
+	factory.NewHistogramVec(prometheus.HistogramOpts{Name: "latency", Help: "Help message"}, []string{"code"})
+	requests.WithLabelValues("acme", "200").Inc()
+	requests.WithLabelValues("acme", "500").Inc()
+	requests.WithLabelValues("initech", "200").Inc()
+	sessions.WithLabelValues("initech").Inc()
+
+	report := catalogue.DeleteEverywhere(prometheus.Labels{"tenant": "acme"}, time.Hour)
+	assert.Len(t, report, 2)
+	assert.ElementsMatch(t, [][]string{{"acme", "200"}, {"acme", "500"}}, report["requests_total"])
+	assert.Empty(t, report["sessions"])
+	assert.Len(t, requests.Inspect(), 1)
+
+	// the tenant is quarantined
+	requests.WithLabelValues("acme", "200").Inc()
+	assert.Len(t, requests.Inspect(), 1)
+
+	assert.Empty(t, DeleteEverywhere(prometheus.Labels{"tenant": "initech"}, 0))
+}
+
+func TestCatalogue_Reconfigure(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	catalogue := NewCatalogue()
+	factory := WithOptions(nil, SmartMetricOpts{WarmUpDuration: time.Hour, Clock: clock}).WithCatalogue(catalogue)
+	requests := factory.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Help message"}, []string{"code"})
+	total := factory.NewCounter(prometheus.CounterOpts{Name: "total", Help: "Help message"})
+	factory.NewGauge(prometheus.GaugeOpts{Name: "gauge", Help: "Help message"})
+	requests.WithLabelValues("200").Inc()
+	total.Inc()
+	assert.Equal(t, 0.0, testutil.ToFloat64(requests))
+	assert.Equal(t, 0.0, testutil.ToFloat64(total))
+
+	catalogue.SetWarmUpDuration(0)
+	catalogue.SetMaxSeries(1)
+	_, err := requests.GetMetricWithLabelValues("500")
+	assert.ErrorIs(t, err, metrics.ErrSeriesLimitReached)
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(requests))
+	assert.Equal(t, 1.0, testutil.ToFloat64(total))
+}
@@ -0,0 +1,212 @@
+package promauto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv is the environment variable holding the path of a configuration file that overrides the path given to
+// LoadConfig.
+const ConfigEnv = "SMART_METRICS_CONFIG"
+
+// DefaultConfig is the Config of the Factories created by With and WithOptions, and thus of the package level
+// NewXXX functions. No Config is used when nil (default).
+var DefaultConfig *Config
+
+// Config holds the options of the metrics by name, so that they can be tuned without changing the code,
+// see LoadConfig and Factory.WithConfig.
+//
+// Example of YAML configuration file (the JSON files have the same structure):
+//
+//	metrics:
+//	  - name: "myapp_*"
+//	    warmUpDuration: 30s
+//	  - name: myapp_requests_total
+//	    expirationDelay: 1h
+//	    maxSeries: 1000
+//	    limitPolicy: evict_least_active
+//	    labelTTLs:
+//	      - labels: {tenant: trial}
+//	        expirationDelay: 5m
+type Config struct {
+	// Metrics are the options of the metrics. All the rules matching the name of a metric apply in order,
+	// each one overriding the options it sets.
+	Metrics []MetricConfig `json:"metrics" yaml:"metrics"`
+}
+
+// MetricConfig holds the options of the metrics matching a name. The options that are not set keep the value given
+// by the Factory.
+type MetricConfig struct {
+	// Name is the fully-qualified name of the metrics, or a pattern with the syntax of path.Match (e.g. "myapp_*").
+	Name               string    `json:"name" yaml:"name"`
+	WarmUpDuration     *Duration `json:"warmUpDuration,omitempty" yaml:"warmUpDuration,omitempty"`
+	ExpirationDelay    *Duration `json:"expirationDelay,omitempty" yaml:"expirationDelay,omitempty"`
+	AdmissionThreshold *int      `json:"admissionThreshold,omitempty" yaml:"admissionThreshold,omitempty"`
+	AdmissionWindow    *Duration `json:"admissionWindow,omitempty" yaml:"admissionWindow,omitempty"`
+	MaxSeries          *int      `json:"maxSeries,omitempty" yaml:"maxSeries,omitempty"`
+	// LimitPolicy is one of reject, evict_least_active and overflow.
+	LimitPolicy   *string `json:"limitPolicy,omitempty" yaml:"limitPolicy,omitempty"`
+	OverflowValue *string `json:"overflowValue,omitempty" yaml:"overflowValue,omitempty"`
+	TopK          *int    `json:"topK,omitempty" yaml:"topK,omitempty"`
+	// LabelTTLs replace the LabelTTLs given by the Factory (see metrics.VectorOpts).
+	LabelTTLs []LabelTTLConfig `json:"labelTTLs,omitempty" yaml:"labelTTLs,omitempty"`
+}
+
+// LabelTTLConfig is the expiration delay of the metrics having some label values, see metrics.LabelTTL.
+type LabelTTLConfig struct {
+	Labels          map[string]string `json:"labels" yaml:"labels"`
+	ExpirationDelay Duration          `json:"expirationDelay" yaml:"expirationDelay"`
+}
+
+// Duration is a time.Duration read from a string like "1m30s" in the configuration files.
+type Duration time.Duration
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s: %w", data, err)
+	}
+	return d.parse(s)
+}
+
+// UnmarshalYAML implements [yaml.Unmarshaler].
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+var limitPolicies = map[string]metrics.LimitPolicy{
+	"reject":             metrics.LimitReject,
+	"evict_least_active": metrics.LimitEvictLeastActive,
+	"overflow":           metrics.LimitOverflow,
+}
+
+// ParseConfig parses a configuration in the JSON format when json is true, in the YAML format otherwise.
+// Unknown fields are rejected.
+func ParseConfig(data []byte, json bool) (*Config, error) {
+	var config Config
+	if json {
+		if err := decodeJSON(data, &config); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func decodeJSON(data []byte, config *Config) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(config)
+}
+
+// LoadConfig reads a configuration file, in the JSON format when its extension is .json and in the YAML format
+// otherwise. The file given by the ConfigEnv environment variable, when set, is read instead.
+func LoadConfig(filename string) (*Config, error) {
+	if env := os.Getenv(ConfigEnv); env != "" {
+		filename = env
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data, strings.EqualFold(filepath.Ext(filename), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", filename, err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	for i, metric := range c.Metrics {
+		if metric.Name == "" {
+			return fmt.Errorf("metrics[%d]: missing name", i)
+		}
+		if _, err := path.Match(metric.Name, ""); err != nil {
+			return fmt.Errorf("metrics[%d]: invalid name %q: %w", i, metric.Name, err)
+		}
+		if metric.LimitPolicy != nil {
+			if _, ok := limitPolicies[*metric.LimitPolicy]; !ok {
+				return fmt.Errorf("metrics[%d]: invalid limit policy %q, expected reject, evict_least_active or overflow", i, *metric.LimitPolicy)
+			}
+		}
+		for j, ttl := range metric.LabelTTLs {
+			if len(ttl.Labels) == 0 {
+				return fmt.Errorf("metrics[%d].labelTTLs[%d]: missing labels", i, j)
+			}
+		}
+	}
+	return nil
+}
+
+// apply returns the given options overridden by the rules matching the name of the metric.
+func (c *Config) apply(name string, opts SmartMetricOpts) SmartMetricOpts {
+	for _, metric := range c.Metrics {
+		if matched, _ := path.Match(metric.Name, name); !matched {
+			continue
+		}
+		if metric.WarmUpDuration != nil {
+			opts.WarmUpDuration = time.Duration(*metric.WarmUpDuration)
+		}
+		if metric.ExpirationDelay != nil {
+			opts.ExpirationDelay = time.Duration(*metric.ExpirationDelay)
+		}
+		if metric.AdmissionThreshold != nil {
+			opts.AdmissionThreshold = *metric.AdmissionThreshold
+		}
+		if metric.AdmissionWindow != nil {
+			opts.AdmissionWindow = time.Duration(*metric.AdmissionWindow)
+		}
+		if metric.MaxSeries != nil {
+			opts.MaxSeries = *metric.MaxSeries
+		}
+		if metric.LimitPolicy != nil {
+			opts.LimitPolicy = limitPolicies[*metric.LimitPolicy]
+		}
+		if metric.OverflowValue != nil {
+			opts.OverflowValue = *metric.OverflowValue
+		}
+		if metric.TopK != nil {
+			opts.TopK = *metric.TopK
+		}
+		if metric.LabelTTLs != nil {
+			opts.LabelTTLs = make([]metrics.LabelTTL, len(metric.LabelTTLs))
+			for i, ttl := range metric.LabelTTLs {
+				opts.LabelTTLs[i] = metrics.LabelTTL{Labels: ttl.Labels, ExpirationDelay: time.Duration(ttl.ExpirationDelay)}
+			}
+		}
+	}
+	return opts
+}
@@ -0,0 +1,114 @@
+package promauto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	yamlConfig, err := ParseConfig([]byte(`
+metrics:
+  - name: "app_*"
+    warmUpDuration: 30s
+    maxSeries: 100
+  - name: app_requests_total
+    expirationDelay: 1h
+    limitPolicy: evict_least_active
+`), false)
+	require.NoError(t, err)
+	jsonConfig, err := ParseConfig([]byte(`{"metrics": [
+		{"name": "app_*", "warmUpDuration": "30s", "maxSeries": 100},
+		{"name": "app_requests_total", "expirationDelay": "1h", "limitPolicy": "evict_least_active"}
+	]}`), true)
+	require.NoError(t, err)
+	assert.Equal(t, yamlConfig, jsonConfig)
+
+	opts := SmartMetricOpts{WarmUpDuration: time.Minute, ExpirationDelay: time.Minute}
+	assert.Equal(t, SmartMetricOpts{
+		WarmUpDuration:  30 * time.Second,
+		ExpirationDelay: time.Hour,
+		VectorOpts:      metrics.VectorOpts{MaxSeries: 100, LimitPolicy: metrics.LimitEvictLeastActive},
+	}, yamlConfig.apply("app_requests_total", opts))
+	assert.Equal(t, SmartMetricOpts{
+		WarmUpDuration:  30 * time.Second,
+		ExpirationDelay: time.Minute,
+		VectorOpts:      metrics.VectorOpts{MaxSeries: 100},
+	}, yamlConfig.apply("app_sessions", opts))
+	assert.Equal(t, opts, yamlConfig.apply("other_requests_total", opts))
+
+	ttlConfig, err := ParseConfig([]byte(`
+metrics:
+  - name: app_jobs
+    labelTTLs:
+      - labels: {kind: batch}
+        expirationDelay: 5m
+`), false)
+	require.NoError(t, err)
+	assert.Equal(t, SmartMetricOpts{
+		VectorOpts: metrics.VectorOpts{LabelTTLs: []metrics.LabelTTL{
+			{Labels: prometheus.Labels{"kind": "batch"}, ExpirationDelay: 5 * time.Minute},
+		}},
+	}, ttlConfig.apply("app_jobs", SmartMetricOpts{}))
+
+	empty, err := ParseConfig(nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Metrics)
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	for name, config := range map[string]string{
+		"missing name":   `metrics: [{warmUpDuration: 1s}]`,
+		"invalid glob":   `metrics: [{name: "app_[", warmUpDuration: 1s}]`,
+		"invalid policy": `metrics: [{name: app, limitPolicy: drop}]`,
+		"invalid delay":  `metrics: [{name: app, expirationDelay: 10}]`,
+		"unknown field":  `metrics: [{name: app, warmup: 1s}]`,
+		"missing labels": `metrics: [{name: app, labelTTLs: [{expirationDelay: 1s}]}]`,
+	} {
+		_, err := ParseConfig([]byte(config), false)
+		assert.Error(t, err, name)
+	}
+	_, err := ParseConfig([]byte(`{"metrics": [{"name": "app", "warmup": "1s"}]}`), true)
+	assert.Error(t, err)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "metrics.yaml")
+	jsonFile := filepath.Join(dir, "metrics.json")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("metrics:\n  - name: app\n    maxSeries: 10\n"), 0o600))
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"metrics": [{"name": "app", "maxSeries": 20}]}`), 0o600))
+
+	config, err := LoadConfig(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, 10, config.apply("app", SmartMetricOpts{}).MaxSeries)
+
+	t.Setenv(ConfigEnv, jsonFile)
+	config, err = LoadConfig(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, 20, config.apply("app", SmartMetricOpts{}).MaxSeries)
+
+	t.Setenv(ConfigEnv, filepath.Join(dir, "missing.yaml"))
+	_, err = LoadConfig(yamlFile)
+	assert.Error(t, err)
+}
+
+func TestFactory_WithConfig(t *testing.T) {
+	config, err := ParseConfig([]byte("metrics:\n  - name: app_requests_total\n    maxSeries: 1\n    limitPolicy: evict_least_active\n"), false)
+	require.NoError(t, err)
+	factory := WithOptions(nil, SmartMetricOpts{}).WithConfig(config)
+	requests := factory.NewGaugeVec(prometheus.GaugeOpts{Namespace: "app", Name: "requests_total", Help: "Help message"}, []string{"code"})
+	sessions := factory.NewGaugeVec(prometheus.GaugeOpts{Namespace: "app", Name: "sessions", Help: "Help message"}, []string{"code"})
+	for _, code := range []string{"200", "500"} {
+		requests.WithLabelValues(code).Inc()
+		sessions.WithLabelValues(code).Inc()
+	}
+	assert.Len(t, requests.Inspect(), 1)
+	assert.Len(t, sessions.Inspect(), 2)
+}
@@ -0,0 +1,158 @@
+package promauto
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+)
+
+// DisabledMetricsEnv is the environment variable read by Catalogue.DisableFromEnv by default.
+const DisabledMetricsEnv = "SMART_METRICS_DISABLED"
+
+// defaultWatchInterval is the polling interval of WatchDisabledFile when none is given.
+const defaultWatchInterval = 10 * time.Second
+
+// SetEnabled disables or re-enables the metrics of the given fully-qualified name (see metrics.Switchable), or only
+// the metric of the given ID (see CatalogueEntry.ID) when the name is followed by constant labels.
+// The name is remembered, so that a metric created later with this name is disabled as well. Re-enabling a name
+// also removes it from the list given to SetDisabled.
+// It returns false when no such metric is in the Catalogue yet or none can be disabled.
+func (c *Catalogue) SetEnabled(name string, enabled bool) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if enabled {
+		delete(c.disabled, name)
+		delete(c.listed, name)
+	} else {
+		c.disabled[name] = true
+	}
+	return c.switchEntries(name, enabled)
+}
+
+// must be called holding c.mutex.Lock
+func (c *Catalogue) switchEntries(name string, enabled bool) bool {
+	switched := false
+	for _, entry := range c.entries {
+		if entry.Name == name || entry.ID == name {
+			switched = setEnabled(entry, enabled) || switched
+		}
+	}
+	return switched
+}
+
+func setEnabled(entry CatalogueEntry, enabled bool) bool {
+	switchable, ok := entry.Collector.(metrics.Switchable)
+	if ok {
+		switchable.SetEnabled(enabled)
+	}
+	return ok
+}
+
+// must be called holding c.mutex
+func (c *Catalogue) isDisabled(name string) bool {
+	return c.disabled[name] || c.listed[name]
+}
+
+// Disabled returns the sorted names of the disabled metrics.
+func (c *Catalogue) Disabled() []string {
+	c.mutex.RLock()
+	names := make([]string, 0, len(c.disabled)+len(c.listed))
+	for name := range c.disabled {
+		names = append(names, name)
+	}
+	for name := range c.listed {
+		if !c.disabled[name] {
+			names = append(names, name)
+		}
+	}
+	c.mutex.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// SetDisabled disables the metrics of the given names, and re-enables the metrics disabled by the previous call that
+// are not listed anymore. The metrics disabled with SetEnabled or DisableFromEnv stay disabled.
+func (c *Catalogue) SetDisabled(names []string) {
+	listed := make(map[string]bool, len(names))
+	for _, name := range names {
+		listed[name] = true
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for name := range c.listed {
+		if !listed[name] && !c.disabled[name] {
+			c.switchEntries(name, true)
+		}
+	}
+	for name := range listed {
+		if !c.isDisabled(name) {
+			c.switchEntries(name, false)
+		}
+	}
+	c.listed = listed
+}
+
+// DisableFromEnv disables the metrics listed in the given environment variable (DisabledMetricsEnv when empty),
+// as a comma-separated list of fully-qualified names.
+func (c *Catalogue) DisableFromEnv(key string) {
+	if key == "" {
+		key = DisabledMetricsEnv
+	}
+	for _, name := range strings.Split(os.Getenv(key), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			c.SetEnabled(name, false)
+		}
+	}
+}
+
+// WatchDisabledFile polls the given file every interval (10 seconds when not positive) and disables the metrics listed
+// in it (see SetDisabled), one fully-qualified name per line, the lines starting with # being ignored. A missing file
+// re-enables the metrics it listed, while the other read errors leave them unchanged. The returned function stops the
+// watch, it can be called several times.
+func (c *Catalogue) WatchDisabledFile(path string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	done := make(chan struct{})
+	var last []byte
+	polled := false
+	poll := func() {
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		if polled && bytes.Equal(content, last) {
+			return
+		}
+		last, polled = content, true
+		var names []string
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				names = append(names, line)
+			}
+		}
+		c.SetDisabled(names)
+	}
+	poll()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				poll()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
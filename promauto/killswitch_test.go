@@ -0,0 +1,96 @@
+package promauto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogue_SetEnabled(t *testing.T) {
+	catalogue := NewCatalogue()
+	factory := WithOptions(nil, SmartMetricOpts{}).WithCatalogue(catalogue)
+	requests := factory.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Help message"}, []string{"code"})
+	requests.WithLabelValues("200").Inc()
+
+	assert.True(t, catalogue.SetEnabled("requests_total", false))
+	assert.Equal(t, 0, testutil.CollectAndCount(requests))
+	assert.False(t, catalogue.SetEnabled("errors_total", false))
+	assert.Equal(t, []string{"errors_total", "requests_total"}, catalogue.Disabled())
+
+	// the metrics created later are disabled as well
+	errors := factory.NewCounter(prometheus.CounterOpts{Name: "errors_total", Help: "Help message"})
+	assert.Equal(t, 0, testutil.CollectAndCount(errors))
+
+	assert.True(t, catalogue.SetEnabled("requests_total", true))
+	requests.WithLabelValues("200").Inc()
+	assert.Equal(t, 1, testutil.CollectAndCount(requests))
+	assert.Equal(t, []string{"errors_total"}, catalogue.Disabled())
+}
+
+func TestCatalogue_SetDisabled(t *testing.T) {
+	catalogue := NewCatalogue()
+	factory := WithOptions(nil, SmartMetricOpts{}).WithCatalogue(catalogue)
+	requests := factory.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Help message"}, []string{"code"})
+	sessions := factory.NewGauge(prometheus.GaugeOpts{Name: "sessions", Help: "Help message"})
+	requests.WithLabelValues("200").Inc()
+	catalogue.SetEnabled("requests_total", false)
+
+	catalogue.SetDisabled([]string{"requests_total", "sessions"})
+	assert.Equal(t, 0, testutil.CollectAndCount(sessions))
+	assert.Equal(t, []string{"requests_total", "sessions"}, catalogue.Disabled())
+
+	// only the metrics disabled by the previous list are re-enabled
+	catalogue.SetDisabled(nil)
+	assert.Equal(t, 1, testutil.CollectAndCount(sessions))
+	requests.WithLabelValues("200").Inc()
+	assert.Equal(t, 0, testutil.CollectAndCount(requests))
+	assert.Equal(t, []string{"requests_total"}, catalogue.Disabled())
+}
+
+func TestCatalogue_DisableFromEnv(t *testing.T) {
+	t.Setenv(DisabledMetricsEnv, "requests_total, errors_total")
+	catalogue := NewCatalogue()
+	catalogue.DisableFromEnv("")
+	assert.Equal(t, []string{"errors_total", "requests_total"}, catalogue.Disabled())
+}
+
+func TestCatalogue_WatchDisabledFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disabled")
+	require.NoError(t, os.WriteFile(path, []byte("# exploding metrics\nrequests_total\n"), 0o600))
+	catalogue := NewCatalogue()
+	stop := catalogue.WatchDisabledFile(path, 10*time.Millisecond)
+	defer stop()
+	assert.Equal(t, []string{"requests_total"}, catalogue.Disabled())
+
+	require.NoError(t, os.WriteFile(path, []byte("errors_total\n"), 0o600))
+	assert.Eventually(t, func() bool {
+		disabled := catalogue.Disabled()
+		return len(disabled) == 1 && disabled[0] == "errors_total"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.Remove(path))
+	assert.Eventually(t, func() bool { return len(catalogue.Disabled()) == 0 }, 5*time.Second, 10*time.Millisecond)
+	stop()
+}
+
+func TestCatalogue_WatchDisabledFileKeepsEnvNames(t *testing.T) {
+	t.Setenv(DisabledMetricsEnv, "requests_total")
+	path := filepath.Join(t.TempDir(), "disabled")
+	require.NoError(t, os.WriteFile(path, []byte("errors_total\n"), 0o600))
+	catalogue := NewCatalogue()
+	catalogue.DisableFromEnv("")
+	// the interval falls back to the default one
+	stop := catalogue.WatchDisabledFile(path, 0)
+	defer stop()
+	assert.Equal(t, []string{"errors_total", "requests_total"}, catalogue.Disabled())
+
+	// the names of the environment variable are not re-enabled by the file
+	catalogue.SetDisabled(nil)
+	assert.Equal(t, []string{"requests_total"}, catalogue.Disabled())
+}
@@ -0,0 +1,79 @@
+package promauto
+
+import (
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option overrides an option of the Factory for a single metric, e.g.
+//
+//	factory.NewHistogramVec(opts, labelNames, promauto.WithExpiration(time.Hour))
+//
+// The options that do not apply to the created metric are ignored, e.g. WithWarmUp for a gauge vector.
+// The Config of the Factory, if any, overrides them like the options of the Factory.
+type Option func(opts *SmartMetricOpts)
+
+// WithWarmUp sets the warm-up duration of the metric.
+func WithWarmUp(d time.Duration) Option {
+	return func(opts *SmartMetricOpts) { opts.WarmUpDuration = d }
+}
+
+// WithExpiration sets the expiration delay of the metric (zero value means infinite expiration time).
+func WithExpiration(d time.Duration) Option {
+	return func(opts *SmartMetricOpts) { opts.ExpirationDelay = d }
+}
+
+// WithClock sets the clock of the metric.
+func WithClock(clock metrics.Clock) Option {
+	return func(opts *SmartMetricOpts) { opts.Clock = clock }
+}
+
+// WithLimit sets the maximum number of metrics exported by the vector and the policy applied when it is full.
+func WithLimit(maxSeries int, policy metrics.LimitPolicy) Option {
+	return func(opts *SmartMetricOpts) {
+		opts.MaxSeries = maxSeries
+		opts.LimitPolicy = policy
+	}
+}
+
+// WithAdmission sets the admission threshold and window of the vector.
+func WithAdmission(threshold int, window time.Duration) Option {
+	return func(opts *SmartMetricOpts) {
+		opts.AdmissionThreshold = threshold
+		opts.AdmissionWindow = window
+	}
+}
+
+// WithBudget shares the given budget of series with the vector, with the given priority.
+func WithBudget(budget *metrics.Budget, priority int) Option {
+	return func(opts *SmartMetricOpts) {
+		opts.Budget = budget
+		opts.BudgetPriority = priority
+	}
+}
+
+// WithTopK enables the top-K mode of the vector.
+func WithTopK(k int) Option {
+	return func(opts *SmartMetricOpts) { opts.TopK = k }
+}
+
+// WithLabelTTL sets the expiration delay of the metrics of the vector having the given label values, in addition to
+// the LabelTTLs of the Factory (see metrics.VectorOpts).
+func WithLabelTTL(labels prometheus.Labels, d time.Duration) Option {
+	return func(opts *SmartMetricOpts) {
+		ttls := opts.LabelTTLs
+		opts.LabelTTLs = append(ttls[:len(ttls):len(ttls)], metrics.LabelTTL{Labels: labels, ExpirationDelay: d})
+	}
+}
+
+// WithTagGenerator sets the generator of the life cycle tags of the vector, see metrics.VectorOpts.
+func WithTagGenerator(generator func(now time.Time, labelValues []string) string) Option {
+	return func(opts *SmartMetricOpts) { opts.TagGenerator = generator }
+}
+
+// WithVectorOpts replaces all the options of the vector.
+func WithVectorOpts(vectorOpts metrics.VectorOpts) Option {
+	return func(opts *SmartMetricOpts) { opts.VectorOpts = vectorOpts }
+}
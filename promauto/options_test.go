@@ -0,0 +1,88 @@
+package promauto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactory_Options(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	factory := WithOptions(nil, SmartMetricOpts{ExpirationDelay: time.Minute, Clock: clock})
+	shortLived := factory.NewGaugeVec(prometheus.GaugeOpts{Name: "short_lived", Help: "Help message"}, []string{"id"})
+	longLived := factory.NewGaugeVec(prometheus.GaugeOpts{Name: "long_lived", Help: "Help message"}, []string{"id"},
+		WithExpiration(time.Hour), WithLimit(1, metrics.LimitEvictLeastActive))
+
+	for _, id := range []string{"a", "b"} {
+		shortLived.WithLabelValues(id).Inc()
+		longLived.WithLabelValues(id).Inc()
+	}
+	assert.Len(t, shortLived.Inspect(), 2)
+	require.Len(t, longLived.Inspect(), 1)
+	assert.Equal(t, []string{"b"}, longLived.Inspect()[0].LabelValues)
+
+	// complete the warm-up, then let the short lived metrics expire
+	for i := 0; i < 2; i++ {
+		shortLived.Collect(make(chan prometheus.Metric, 10))
+		longLived.Collect(make(chan prometheus.Metric, 10))
+		clock.Advance(time.Second)
+	}
+	clock.Advance(2 * time.Minute)
+	assert.Empty(t, shortLived.Inspect())
+	assert.Len(t, longLived.Inspect(), 1)
+}
+
+func TestFactory_WithLabelTTL(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	factory := WithOptions(nil, SmartMetricOpts{ExpirationDelay: time.Hour, Clock: clock})
+	jobs := factory.NewGaugeVec(prometheus.GaugeOpts{Name: "jobs", Help: "Help message"}, []string{"kind"},
+		WithLabelTTL(prometheus.Labels{"kind": "batch"}, time.Minute))
+	jobs.WithLabelValues("batch").Set(1)
+	jobs.WithLabelValues("web").Set(1)
+
+	// complete the warm-up, then let the batch metric expire
+	for i := 0; i < 2; i++ {
+		jobs.Collect(make(chan prometheus.Metric, 10))
+		clock.Advance(time.Second)
+	}
+	clock.Advance(2 * time.Minute)
+	require.Len(t, jobs.Inspect(), 1)
+	assert.Equal(t, []string{"web"}, jobs.Inspect()[0].LabelValues)
+}
+
+func TestFactory_WithOpts(t *testing.T) {
+	config, err := ParseConfig([]byte("metrics:\n  - name: requests_total\n    maxSeries: 5\n"), false)
+	require.NoError(t, err)
+	factory := WithOptions(nil, SmartMetricOpts{WarmUpDuration: time.Hour}).WithConfig(config)
+
+	// the options of the Factory are not used, the Config still applies
+	counterVec := factory.NewCounterVecWithOpts(metrics.CounterOpts{
+		CounterOpts:  prometheus.CounterOpts{Name: "requests_total", Help: "Help message"},
+		RollupLabels: prometheus.Labels{"tenant": "__expired__"},
+		VectorOpts:   metrics.VectorOpts{MaxSeries: 1},
+	}, []string{"tenant"})
+	for _, tenant := range []string{"a", "b", "c"} {
+		counterVec.WithLabelValues(tenant).Inc()
+	}
+	assert.Len(t, counterVec.Inspect(), 3)
+
+	counter := factory.NewCounterWithOpts(metrics.CounterOpts{CounterOpts: prometheus.CounterOpts{Name: "events_total", Help: "Help message"}})
+	counter.Inc()
+	// no warm-up duration: the value is collected from the second collection
+	assert.Equal(t, 0.0, testutil.ToFloat64(counter))
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter))
+}
+
+func TestFactory_WithTagGenerator(t *testing.T) {
+	vec := With(nil).NewGaugeVec(prometheus.GaugeOpts{Name: "sessions", Help: "Help message"}, []string{"id"},
+		WithTagGenerator(func(now time.Time, labelValues []string) string { return "instance-1" }))
+	vec.WithLabelValues("a").Inc()
+	require.Len(t, vec.Inspect(), 1)
+	assert.Equal(t, "instance-1", vec.Inspect()[0].Tag)
+}
@@ -0,0 +1,396 @@
+package promhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+)
+
+// AdminHandlerOpts are the options of an AdminHandler.
+type AdminHandlerOpts struct {
+	// AllowDelete enables the deletion of series.
+	AllowDelete bool
+	// AllowReset enables the reset of vectors.
+	AllowReset bool
+	// Clock provides the time (the system clock by default), used to compute the time to expiry of the series.
+	Clock metrics.Clock
+}
+
+// AdminHandler is an [http.Handler] to inspect and manage the vectors of metrics of a process, e.g. during incidents.
+//
+// It knows about the vectors added explicitly with AddVector and the vectors created with it as Observer in their
+// options (e.g. promauto.DefaultOptions.Observer), see [metrics.VectorOpts].
+//
+// A GET request lists the series of the vectors with their life cycle tag, state and time to expiry, as HTML or as
+// JSON (with the format=json query parameter or an Accept header preferring application/json). The match query
+// parameter filters the series with label matchers, e.g. match={tenant="acme",code=~"5.."}, the __name__ label being
+// the name of the vector.
+//
+// When enabled in the options, a POST request deletes a series or resets a vector, with the form parameters:
+//   - action=delete, vector=<ID> and label.<label name>=<value> for each label of the vector
+//   - action=reset and vector=<ID>
+//
+// The vectors are identified by their ID (see metrics.Vector), i.e. their name for the vectors without constant labels.
+//
+// The actions are answered with a JSON result, or redirected to the listing for the HTML forms.
+// The actions sent by a browser from another origin (according to the Sec-Fetch-Site, Origin or Referer headers) are
+// rejected, so that another site cannot make the browser of an operator post them. The handler is not protected
+// otherwise and should only be served on an internal endpoint.
+type AdminHandler struct {
+	opts    AdminHandlerOpts
+	mutex   sync.RWMutex
+	vectors map[string]metrics.Vector
+}
+
+// NewAdminHandler creates a new AdminHandler knowing no vector.
+func NewAdminHandler(opts AdminHandlerOpts) *AdminHandler {
+	return &AdminHandler{opts: opts, vectors: make(map[string]metrics.Vector)}
+}
+
+// AddVector adds a vector to the handler, replacing the vector of the same ID if any.
+// It implements [metrics.VectorObserver] along with RemoveVector.
+func (h *AdminHandler) AddVector(vector metrics.Vector) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.vectors[vector.ID()] = vector
+}
+
+// RemoveVector removes the vector from the handler, unless it was replaced by another vector of the same ID.
+func (h *AdminHandler) RemoveVector(vector metrics.Vector) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.vectors[vector.ID()] == vector {
+		delete(h.vectors, vector.ID())
+	}
+}
+
+func (h *AdminHandler) vector(id string) metrics.Vector {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.vectors[id]
+}
+
+func (h *AdminHandler) sortedVectors() []metrics.Vector {
+	h.mutex.RLock()
+	vectors := make([]metrics.Vector, 0, len(h.vectors))
+	for _, vector := range h.vectors {
+		vectors = append(vectors, vector)
+	}
+	h.mutex.RUnlock()
+	sort.Slice(vectors, func(i, j int) bool { return vectors[i].ID() < vectors[j].ID() })
+	return vectors
+}
+
+func (h *AdminHandler) now() time.Time {
+	if h.opts.Clock == nil {
+		return time.Now()
+	}
+	return h.opts.Clock.Now()
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.serveListing(w, req)
+	case http.MethodPost:
+		h.serveAction(w, req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type vectorListing struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	LabelNames []string        `json:"labelNames"`
+	Series     []seriesListing `json:"series"`
+}
+
+type seriesListing struct {
+	Labels     map[string]string `json:"labels"`
+	Tag        string            `json:"tag"`
+	State      string            `json:"state"`
+	LastAccess time.Time         `json:"lastAccess"`
+	ExpiresAt  *time.Time        `json:"expiresAt,omitempty"`
+	// time to expiry in seconds, negative when the series is waiting for its removal
+	ExpiresIn *float64 `json:"expiresInSeconds,omitempty"`
+	// label values in the order of the label names of the vector, for the HTML listing
+	values []string
+}
+
+// Values returns the label values of the series in the order of the label names of its vector.
+func (s seriesListing) Values() []string {
+	return s.values
+}
+
+func (h *AdminHandler) serveListing(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	match := query.Get("match")
+	matchers, err := parseMatchers(match)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid match parameter: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	now := h.now()
+	listings := []vectorListing{}
+	for _, vector := range h.sortedVectors() {
+		listing := vectorListing{ID: vector.ID(), Name: vector.Name(), LabelNames: vector.LabelNames(), Series: []seriesListing{}}
+		for _, info := range vector.Inspect() {
+			labels := make(map[string]string, len(listing.LabelNames))
+			for i, name := range listing.LabelNames {
+				labels[name] = info.LabelValues[i]
+			}
+			if !matchAll(matchers, listing.Name, labels) {
+				continue
+			}
+			series := seriesListing{Labels: labels, Tag: info.Tag, State: info.State, LastAccess: info.LastAccess, values: info.LabelValues}
+			if !info.ExpiresAt.IsZero() {
+				expiresAt, expiresIn := info.ExpiresAt, info.ExpiresAt.Sub(now).Seconds()
+				series.ExpiresAt, series.ExpiresIn = &expiresAt, &expiresIn
+			}
+			listing.Series = append(listing.Series, series)
+		}
+		if len(matchers) > 0 && len(listing.Series) == 0 {
+			continue
+		}
+		listings = append(listings, listing)
+	}
+
+	if wantsJSON(req) {
+		writeJSON(w, http.StatusOK, struct {
+			Vectors []vectorListing `json:"vectors"`
+		}{listings})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = adminTemplate.Execute(w, struct {
+		Match       string
+		Vectors     []vectorListing
+		AllowDelete bool
+		AllowReset  bool
+	}{match, listings, h.opts.AllowDelete, h.opts.AllowReset})
+}
+
+func (h *AdminHandler) serveAction(w http.ResponseWriter, req *http.Request) {
+	if !sameOrigin(req) {
+		http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("invalid form: %v", err), http.StatusBadRequest)
+		return
+	}
+	action := req.PostForm.Get("action")
+	switch {
+	case action == "delete" && !h.opts.AllowDelete, action == "reset" && !h.opts.AllowReset:
+		http.Error(w, fmt.Sprintf("action %s is not allowed", action), http.StatusForbidden)
+		return
+	case action != "delete" && action != "reset":
+		http.Error(w, fmt.Sprintf("unknown action %q, expected delete or reset", action), http.StatusBadRequest)
+		return
+	}
+	id := req.PostForm.Get("vector")
+	vector := h.vector(id)
+	if vector == nil {
+		http.Error(w, fmt.Sprintf("unknown vector %q", id), http.StatusNotFound)
+		return
+	}
+
+	result := struct {
+		Vector  string `json:"vector"`
+		Action  string `json:"action"`
+		Deleted *bool  `json:"deleted,omitempty"`
+	}{Vector: id, Action: action}
+	if action == "delete" {
+		labelNames := vector.LabelNames()
+		labelValues := make([]string, len(labelNames))
+		for i, labelName := range labelNames {
+			values, found := req.PostForm["label."+labelName]
+			if !found || len(values) != 1 {
+				http.Error(w, fmt.Sprintf("expected a single value for the label %s", labelName), http.StatusBadRequest)
+				return
+			}
+			labelValues[i] = values[0]
+		}
+		deleted := vector.DeleteLabelValues(labelValues...)
+		result.Deleted = &deleted
+	} else {
+		vector.Reset()
+	}
+
+	if wantsJSON(req) {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	http.Redirect(w, req, req.URL.Path+"?match="+url.QueryEscape(req.PostForm.Get("match")), http.StatusSeeOther)
+}
+
+// sameOrigin returns false when a request was sent by a browser from another origin, e.g. a form of another site
+// posted to the internal endpoint of the handler. The requests that do not come from a browser (without
+// Sec-Fetch-Site, Origin and Referer headers) are accepted.
+func sameOrigin(req *http.Request) bool {
+	if site := req.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		origin = req.Header.Get("Referer")
+		if origin == "" {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, req.Host)
+}
+
+func wantsJSON(req *http.Request) bool {
+	if format := req.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	accept := req.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// labelMatcher is a Prometheus label matcher, e.g. code=~"5..".
+type labelMatcher struct {
+	name  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (m labelMatcher) matches(value string) bool {
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default: // "!~"
+		return !m.re.MatchString(value)
+	}
+}
+
+// matchAll returns true when the series of the given vector and labels matches all the matchers.
+// A missing label has an empty value, like in Prometheus.
+func matchAll(matchers []labelMatcher, name string, labels map[string]string) bool {
+	for _, m := range matchers {
+		value := labels[m.name]
+		if m.name == "__name__" {
+			value = name
+		}
+		if !m.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// parseMatchers parses a list of label matchers separated by commas, optionally surrounded by braces,
+// e.g. {tenant="acme",code=~"5.."}. The values are Go quoted strings.
+func parseMatchers(s string) ([]labelMatcher, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	var matchers []labelMatcher
+	for s != "" {
+		var m labelMatcher
+		m.name = labelNameRegexp.FindString(s)
+		if m.name == "" {
+			return nil, fmt.Errorf("expected a label name at %q", s)
+		}
+		s = strings.TrimSpace(s[len(m.name):])
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, op) {
+				m.op = op
+				break
+			}
+		}
+		if m.op == "" {
+			return nil, fmt.Errorf("expected an operator (=, !=, =~ or !~) at %q", s)
+		}
+		s = strings.TrimSpace(s[len(m.op):])
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected a quoted value at %q", s)
+		}
+		if m.value, err = strconv.Unquote(quoted); err != nil {
+			return nil, fmt.Errorf("invalid value %s: %w", quoted, err)
+		}
+		if m.op == "=~" || m.op == "!~" {
+			// anchored like in Prometheus
+			if m.re, err = regexp.Compile("^(?:" + m.value + ")$"); err != nil {
+				return nil, fmt.Errorf("invalid regular expression %s: %w", quoted, err)
+			}
+		}
+		matchers = append(matchers, m)
+		s = strings.TrimSpace(s[len(quoted):])
+		if s != "" {
+			if s[0] != ',' {
+				return nil, fmt.Errorf("expected a comma at %q", s)
+			}
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+	return matchers, nil
+}
+
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"seconds": func(seconds *float64) string {
+		if seconds == nil {
+			return "-"
+		}
+		return (time.Duration(*seconds) * time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>Smart vectors</title></head>
+<body>
+<h1>Smart vectors</h1>
+<form method="get">
+<input type="text" name="match" size="80" value="{{.Match}}" placeholder="{tenant=&quot;acme&quot;,code=~&quot;5..&quot;}">
+<input type="submit" value="Filter">
+</form>
+{{$root := .}}
+{{range .Vectors}}{{$vector := .}}
+<h2>{{.ID}} ({{len .Series}} series)</h2>
+{{if $root.AllowReset}}<form method="post" onsubmit="return confirm('Reset {{.ID}}?')">
+<input type="hidden" name="action" value="reset"><input type="hidden" name="vector" value="{{.ID}}">
+<input type="hidden" name="match" value="{{$root.Match}}"><input type="submit" value="Reset">
+</form>{{end}}
+<table border="1">
+<tr>{{range .LabelNames}}<th>{{.}}</th>{{end}}<th>tag</th><th>state</th><th>last access</th><th>expires in</th>{{if $root.AllowDelete}}<th></th>{{end}}</tr>
+{{range .Series}}<tr>{{range .Values}}<td>{{.}}</td>{{end}}<td>{{.Tag}}</td><td>{{.State}}</td><td>{{.LastAccess.Format "2006-01-02T15:04:05Z07:00"}}</td><td>{{seconds .ExpiresIn}}</td>
+{{if $root.AllowDelete}}<td><form method="post">
+<input type="hidden" name="action" value="delete"><input type="hidden" name="vector" value="{{$vector.ID}}">
+{{range $name, $value := .Labels}}<input type="hidden" name="label.{{$name}}" value="{{$value}}">{{end}}
+<input type="hidden" name="match" value="{{$root.Match}}"><input type="submit" value="Delete">
+</form></td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
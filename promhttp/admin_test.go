@@ -0,0 +1,218 @@
+package promhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdminTestVectors(clock metrics.Clock, admin *AdminHandler) (*metrics.MetricVec[prometheus.Counter], *metrics.MetricVec[prometheus.Gauge]) {
+	counter := metrics.NewCounterVec(metrics.CounterOpts{
+		CounterOpts:     prometheus.CounterOpts{Namespace: "app", Name: "requests_total", Help: "Help message"},
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+		VectorOpts:      metrics.VectorOpts{Observer: admin},
+	}, []string{"tenant", "code"})
+	gauge := metrics.NewGaugeVec(metrics.GaugeOpts{
+		GaugeOpts: prometheus.GaugeOpts{Namespace: "app", Name: "sessions", Help: "Help message"},
+		Clock:     clock,
+	}, []string{"tenant"})
+	admin.AddVector(gauge)
+	counter.WithLabelValues("acme", "200").Inc()
+	counter.WithLabelValues("acme", "503").Inc()
+	counter.WithLabelValues("initech", "200").Inc()
+	gauge.WithLabelValues("acme").Set(3)
+	return counter, gauge
+}
+
+type adminListing struct {
+	Vectors []struct {
+		Name       string   `json:"name"`
+		LabelNames []string `json:"labelNames"`
+		Series     []struct {
+			Labels    map[string]string `json:"labels"`
+			Tag       string            `json:"tag"`
+			State     string            `json:"state"`
+			ExpiresIn *float64          `json:"expiresInSeconds"`
+		} `json:"series"`
+	} `json:"vectors"`
+}
+
+func getListing(t *testing.T, handler http.Handler, match string) adminListing {
+	req := httptest.NewRequest(http.MethodGet, "/admin?format=json&match="+url.QueryEscape(match), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listing adminListing
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	return listing
+}
+
+func postAction(handler http.Handler, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin?format=json", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminHandler_Listing(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	admin := NewAdminHandler(AdminHandlerOpts{Clock: clock})
+	newAdminTestVectors(clock, admin)
+
+	listing := getListing(t, admin, "")
+	require.Len(t, listing.Vectors, 2)
+	assert.Equal(t, "app_requests_total", listing.Vectors[0].Name)
+	assert.Equal(t, []string{"tenant", "code"}, listing.Vectors[0].LabelNames)
+	require.Len(t, listing.Vectors[0].Series, 3)
+	series := listing.Vectors[0].Series[0]
+	assert.Equal(t, map[string]string{"tenant": "acme", "code": "200"}, series.Labels)
+	assert.Equal(t, "48ab9774", series.Tag)
+	assert.Equal(t, metrics.SeriesWarmUpPending, series.State)
+	assert.Nil(t, series.ExpiresIn)
+	assert.Equal(t, "app_sessions", listing.Vectors[1].Name)
+
+	// the time to expiry is known once the warm-up is complete
+	admin.vector("app_requests_total").Collect(make(chan prometheus.Metric, 10))
+	clock.Advance(time.Second)
+	admin.vector("app_requests_total").Collect(make(chan prometheus.Metric, 10))
+	clock.Advance(10 * time.Second)
+	series = getListing(t, admin, "").Vectors[0].Series[0]
+	assert.Equal(t, metrics.SeriesWarmUpComplete, series.State)
+	require.NotNil(t, series.ExpiresIn)
+	assert.Equal(t, 49.0, *series.ExpiresIn)
+
+	// filtering
+	listing = getListing(t, admin, `{tenant="acme",code=~"5.."}`)
+	require.Len(t, listing.Vectors, 1)
+	require.Len(t, listing.Vectors[0].Series, 1)
+	assert.Equal(t, "503", listing.Vectors[0].Series[0].Labels["code"])
+	listing = getListing(t, admin, `__name__="app_sessions"`)
+	require.Len(t, listing.Vectors, 1)
+	assert.Equal(t, "app_sessions", listing.Vectors[0].Name)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin?match="+url.QueryEscape(`tenant~"acme"`), nil)
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminHandler_HTML(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	admin := NewAdminHandler(AdminHandlerOpts{AllowDelete: true, Clock: clock})
+	newAdminTestVectors(clock, admin)
+
+	body := scrape(t, admin, "text/html")
+	assert.Contains(t, body, "<h2>app_requests_total (3 series)</h2>")
+	assert.Contains(t, body, `<input type="hidden" name="label.tenant" value="initech">`)
+	assert.NotContains(t, body, `value="Reset"`)
+}
+
+func TestAdminHandler_Actions(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	counter, gauge := newAdminTestVectors(clock, NewAdminHandler(AdminHandlerOpts{}))
+
+	// the actions are disabled by default
+	readOnly := NewAdminHandler(AdminHandlerOpts{Clock: clock})
+	readOnly.AddVector(counter)
+	rec := postAction(readOnly, url.Values{"action": {"delete"}, "vector": {"app_requests_total"},
+		"label.tenant": {"acme"}, "label.code": {"200"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Len(t, counter.Inspect(), 3)
+
+	admin := NewAdminHandler(AdminHandlerOpts{AllowDelete: true, AllowReset: true, Clock: clock})
+	admin.AddVector(counter)
+	admin.AddVector(gauge)
+	rec = postAction(admin, url.Values{"action": {"delete"}, "vector": {"app_requests_total"},
+		"label.tenant": {"acme"}, "label.code": {"200"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"vector":"app_requests_total","action":"delete","deleted":true}`, rec.Body.String())
+	assert.Len(t, counter.Inspect(), 2)
+
+	rec = postAction(admin, url.Values{"action": {"delete"}, "vector": {"app_requests_total"}, "label.tenant": {"acme"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = postAction(admin, url.Values{"action": {"reset"}, "vector": {"unknown"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = postAction(admin, url.Values{"action": {"reset"}, "vector": {"app_sessions"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, gauge.Inspect())
+	assert.Len(t, counter.Inspect(), 2)
+
+	admin.RemoveVector(gauge)
+	rec = postAction(admin, url.Values{"action": {"reset"}, "vector": {"app_sessions"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminHandler_SameNameWithDifferentConstLabels(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	admin := NewAdminHandler(AdminHandlerOpts{AllowReset: true, Clock: clock})
+	vectors := make([]*metrics.MetricVec[prometheus.Gauge], 2)
+	for i, component := range []string{"a", "b"} {
+		vectors[i] = metrics.NewGaugeVec(metrics.GaugeOpts{
+			GaugeOpts: prometheus.GaugeOpts{Name: "sessions", Help: "Help message", ConstLabels: prometheus.Labels{"component": component}},
+			Clock:     clock,
+		}, []string{"tenant"})
+		vectors[i].WithLabelValues("acme").Set(1)
+		admin.AddVector(vectors[i])
+	}
+	assert.Len(t, getListing(t, admin, "").Vectors, 2)
+
+	rec := postAction(admin, url.Values{"action": {"reset"}, "vector": {`sessions{component="a"}`}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, vectors[0].Inspect())
+	assert.Len(t, vectors[1].Inspect(), 1)
+
+	admin.RemoveVector(vectors[0])
+	assert.Len(t, getListing(t, admin, "").Vectors, 1)
+}
+
+func TestAdminHandler_RejectsCrossOriginActions(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	admin := NewAdminHandler(AdminHandlerOpts{AllowReset: true, Clock: clock})
+	_, gauge := newAdminTestVectors(clock, admin)
+
+	post := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin?format=json", strings.NewReader("action=reset&vector=app_sessions"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, post("Sec-Fetch-Site", "cross-site"))
+	assert.Equal(t, http.StatusForbidden, post("Origin", "https://attacker.example"))
+	assert.Equal(t, http.StatusForbidden, post("Origin", "null"))
+	assert.Equal(t, http.StatusForbidden, post("Referer", "https://attacker.example/page"))
+	assert.Len(t, gauge.Inspect(), 1)
+
+	// httptest requests are sent to example.com
+	assert.Equal(t, http.StatusOK, post("Origin", "http://example.com"))
+	assert.Empty(t, gauge.Inspect())
+	assert.Equal(t, http.StatusOK, post("Sec-Fetch-Site", "same-origin"))
+}
+
+func TestParseMatchers(t *testing.T) {
+	matchers, err := parseMatchers(` { tenant = "acme", code!~"5..",path=~"/a\\.b" } `)
+	require.NoError(t, err)
+	require.Len(t, matchers, 3)
+	assert.True(t, matchAll(matchers, "name", map[string]string{"tenant": "acme", "code": "200", "path": "/a.b"}))
+	assert.False(t, matchAll(matchers, "name", map[string]string{"tenant": "acme", "code": "500", "path": "/a.b"}))
+	assert.False(t, matchAll(matchers, "name", map[string]string{"tenant": "acme", "code": "200", "path": "/a.b/c"}))
+
+	for _, invalid := range []string{`tenant`, `tenant="acme" code="200"`, `tenant=acme`, `code=~"("`} {
+		_, err := parseMatchers(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
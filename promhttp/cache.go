@@ -0,0 +1,264 @@
+package promhttp
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// labelSep separates the label values in the sort key of a series, it is lower than any other character
+// so that the series are sorted like the prometheus registry sorts them.
+const labelSep = "\x00"
+
+// family holds the encoded header of a metric family.
+type family struct {
+	name string
+	help string
+	typ  dto.MetricType
+	// HELP and TYPE lines of the text format
+	textHeader []byte
+	// name, help and type fields of the protobuf message
+	protoHeader []byte
+}
+
+// seriesEntry holds the encoded representations of a series, valid as long as its value is unchanged.
+type seriesEntry struct {
+	family  *family
+	metric  *dto.Metric
+	sortKey string
+	text    []byte
+	// metric field of the protobuf message of the family, with its tag and length
+	proto []byte
+	// number of the last collection the series was part of
+	generation uint64
+}
+
+// encodingCache caches the encoded representation of the series of a set of collectors, indexed by metric instance.
+// The metrics of the vectors of this library are the same instances while their label values are live,
+// so that the encoding of a series is only recomputed when its value or its warm-up state changes.
+type encodingCache struct {
+	families   map[*prometheus.Desc]*family
+	series     map[prometheus.Metric]*seriesEntry
+	generation uint64
+}
+
+func newEncodingCache() *encodingCache {
+	return &encodingCache{
+		families: make(map[*prometheus.Desc]*family),
+		series:   make(map[prometheus.Metric]*seriesEntry),
+	}
+}
+
+// snapshot is the result of a collection: the series of each family, sorted like the prometheus registry sorts them.
+type snapshot struct {
+	families []*family
+	series   [][]*seriesEntry
+}
+
+// update updates the cache with the given collected metrics, encoding the series that changed, and removes the
+// series that were not collected (e.g. expired or deleted ones).
+//
+// Like the prometheus registry, it reports an error for each series collected twice with the same label values, and
+// for each metric whose family was collected with a different type or help.
+func (c *encodingCache) update(metrics []prometheus.Metric) (*snapshot, []error) {
+	c.generation++
+	var errs []error
+	byName := make(map[string]int)
+	snap := &snapshot{}
+	for _, metric := range metrics {
+		entry, err := c.entry(metric)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		i, present := byName[entry.family.name]
+		if !present {
+			i = len(snap.families)
+			byName[entry.family.name] = i
+			snap.families = append(snap.families, entry.family)
+			snap.series = append(snap.series, nil)
+		} else if fam := snap.families[i]; fam != entry.family && (fam.typ != entry.family.typ || fam.help != entry.family.help) {
+			errs = append(errs, fmt.Errorf("collected metric %q %s has help %q and type %s but should have help %q and type %s",
+				fam.name, entry.metric, entry.family.help, entry.family.typ, fam.help, fam.typ))
+			continue
+		}
+		snap.series[i] = append(snap.series[i], entry)
+	}
+	for metric, entry := range c.series {
+		if entry.generation != c.generation {
+			delete(c.series, metric)
+		}
+	}
+	for desc, fam := range c.families {
+		if _, present := byName[fam.name]; !present {
+			delete(c.families, desc)
+		}
+	}
+	sort.Sort(snap)
+	for f, series := range snap.series {
+		sort.Slice(series, func(i, j int) bool { return series[i].sortKey < series[j].sortKey })
+		for i := 1; i < len(series); i++ {
+			if series[i].sortKey == series[i-1].sortKey && sameLabelNames(series[i].metric, series[i-1].metric) {
+				errs = append(errs, fmt.Errorf("collected metric %q %s was collected before with the same name and label values",
+					snap.families[f].name, series[i].metric))
+			}
+		}
+	}
+	return snap, errs
+}
+
+// sameLabelNames returns true when two series have the same label names.
+func sameLabelNames(a, b *dto.Metric) bool {
+	if len(a.Label) != len(b.Label) {
+		return false
+	}
+	for i, pair := range a.Label {
+		if pair.GetName() != b.Label[i].GetName() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *snapshot) Len() int           { return len(s.families) }
+func (s *snapshot) Less(i, j int) bool { return s.families[i].name < s.families[j].name }
+func (s *snapshot) Swap(i, j int) {
+	s.families[i], s.families[j] = s.families[j], s.families[i]
+	s.series[i], s.series[j] = s.series[j], s.series[i]
+}
+
+// entry returns the cache entry of a collected metric, encoding it if it is new or if its value changed.
+func (c *encodingCache) entry(metric prometheus.Metric) (*seriesEntry, error) {
+	out := &dto.Metric{}
+	if err := metric.Write(out); err != nil {
+		return nil, fmt.Errorf("error collecting metric %v: %w", metric.Desc(), err)
+	}
+	entry := c.series[metric]
+	if entry != nil && sameValue(entry.metric, out) {
+		entry.generation = c.generation
+		return entry, nil
+	}
+	fam, err := c.family(metric, out)
+	if err != nil {
+		return nil, err
+	}
+	entry, err = newSeriesEntry(fam, out)
+	if err != nil {
+		return nil, err
+	}
+	entry.generation = c.generation
+	c.series[metric] = entry
+	return entry, nil
+}
+
+// family returns the family of a metric. The name and help of a family are not exposed by its descriptor,
+// they are obtained once per descriptor by gathering the metric with a prometheus registry.
+func (c *encodingCache) family(metric prometheus.Metric, out *dto.Metric) (*family, error) {
+	if fam := c.families[metric.Desc()]; fam != nil {
+		return fam, nil
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(singleMetricCollector{metric}); err != nil {
+		return nil, err
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	if len(mfs) != 1 {
+		return nil, fmt.Errorf("error collecting metric %v: no metric family", metric.Desc())
+	}
+	fam := &family{name: mfs[0].GetName(), help: mfs[0].GetHelp(), typ: mfs[0].GetType()}
+
+	var text bytes.Buffer
+	if _, err := expfmt.MetricFamilyToText(&text, &dto.MetricFamily{Name: &fam.name, Help: &fam.help, Type: &fam.typ, Metric: []*dto.Metric{out}}); err != nil {
+		return nil, err
+	}
+	series, err := encodeText(fam, out)
+	if err != nil {
+		return nil, err
+	}
+	fam.textHeader = text.Bytes()[:text.Len()-len(series)]
+	if fam.protoHeader, err = proto.Marshal(&dto.MetricFamily{Name: &fam.name, Help: &fam.help, Type: &fam.typ}); err != nil {
+		return nil, err
+	}
+	c.families[metric.Desc()] = fam
+	return fam, nil
+}
+
+func newSeriesEntry(fam *family, out *dto.Metric) (*seriesEntry, error) {
+	text, err := encodeText(fam, out)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := proto.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	// field 4 (metric) of the MetricFamily message, length-delimited
+	field := proto.EncodeVarint(4<<3 | 2)
+	field = append(field, proto.EncodeVarint(uint64(len(encoded)))...)
+	field = append(field, encoded...)
+
+	labelValues := make([]string, len(out.Label))
+	for i, pair := range out.Label {
+		labelValues[i] = pair.GetValue()
+	}
+	return &seriesEntry{
+		family:  fam,
+		metric:  out,
+		sortKey: strings.Join(labelValues, labelSep),
+		text:    text,
+		proto:   field,
+	}, nil
+}
+
+// encodeText returns the lines of a series in the text format.
+func encodeText(fam *family, out *dto.Metric) ([]byte, error) {
+	var text bytes.Buffer
+	if _, err := expfmt.MetricFamilyToText(&text, &dto.MetricFamily{Name: &fam.name, Type: &fam.typ, Metric: []*dto.Metric{out}}); err != nil {
+		return nil, err
+	}
+	// skip the TYPE line
+	encoded := text.Bytes()
+	return encoded[bytes.IndexByte(encoded, '\n')+1:], nil
+}
+
+// sameValue returns true when two collections of the same metric have the same value.
+func sameValue(a, b *dto.Metric) bool {
+	if a.GetTimestampMs() != b.GetTimestampMs() {
+		return false
+	}
+	switch {
+	case a.Counter != nil && a.Counter.Exemplar == nil:
+		return b.Counter != nil && b.Counter.Exemplar == nil && sameFloat(a.Counter.GetValue(), b.Counter.GetValue())
+	case a.Gauge != nil:
+		return b.Gauge != nil && sameFloat(a.Gauge.GetValue(), b.Gauge.GetValue())
+	case a.Untyped != nil:
+		return b.Untyped != nil && sameFloat(a.Untyped.GetValue(), b.Untyped.GetValue())
+	}
+	return proto.Equal(a, b)
+}
+
+func sameFloat(a, b float64) bool {
+	return math.Float64bits(a) == math.Float64bits(b)
+}
+
+type singleMetricCollector struct {
+	metric prometheus.Metric
+}
+
+func (c singleMetricCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.metric.Desc()
+}
+
+func (c singleMetricCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- c.metric
+}
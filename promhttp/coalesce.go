@@ -0,0 +1,140 @@
+package promhttp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// coalescedCall is a call shared by several callers of a coalescer.
+type coalescedCall[T any] struct {
+	done      chan struct{}
+	result    T
+	err       error
+	completed time.Time
+}
+
+// coalescer shares the result of a call between the concurrent callers, and with the callers arriving within
+// a freshness window after its completion.
+type coalescer[T any] struct {
+	window time.Duration
+	clock  metrics.Clock
+	mutex  sync.Mutex
+	// last call, in progress or completed
+	last *coalescedCall[T]
+	// joined, if not nil, is called when a caller starts waiting for the call in progress
+	joined func()
+}
+
+func (c *coalescer[T]) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// do returns the result of the call in progress or of the last call if it is still fresh, otherwise it calls f.
+// shared is true when the result of another call is returned.
+// A panic of f is returned as an error to all the callers sharing the call.
+func (c *coalescer[T]) do(f func() (T, error)) (result T, shared bool, err error) {
+	c.mutex.Lock()
+	if call := c.last; call != nil {
+		select {
+		case <-call.done:
+			if c.window <= 0 || c.now().Sub(call.completed) >= c.window {
+				// a completed call is only shared within its freshness window
+				break
+			}
+			c.mutex.Unlock()
+			return call.result, true, call.err
+		default:
+			c.mutex.Unlock()
+			if c.joined != nil {
+				c.joined()
+			}
+			<-call.done
+			return call.result, true, call.err
+		}
+	}
+	call := &coalescedCall[T]{done: make(chan struct{})}
+	c.last = call
+	c.mutex.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			var zero T
+			call.result, call.err = zero, fmt.Errorf("panic while collecting: %v", r)
+			result, err = call.result, call.err
+		}
+		call.completed = c.now()
+		if call.err != nil {
+			// a failed call is only shared with the concurrent callers, the next ones try again
+			c.mutex.Lock()
+			if c.last == call {
+				c.last = nil
+			}
+			c.mutex.Unlock()
+		}
+		close(call.done)
+	}()
+	call.result, call.err = f()
+	return call.result, false, call.err
+}
+
+// CoalescingOpts are the options of the scrape coalescing.
+type CoalescingOpts struct {
+	// FreshnessWindow is the time during which the result of a collection is shared with the new scrapes
+	// after its completion. Zero value means that only the concurrent scrapes share the same collection.
+	FreshnessWindow time.Duration
+	// Clock provides the time (the system clock by default).
+	Clock metrics.Clock
+}
+
+// CoalescingGatherer is a [prometheus.Gatherer] that deduplicates the concurrent and near-simultaneous gatherings
+// (e.g. the scrapes of several Prometheus servers) into a single gathering of the underlying Gatherer, whose result
+// is shared. This spares the CPU of the collections and the contention on the locks of the vectors.
+//
+// Every scrape sharing a collection sees the metrics in the same state as the scrape that triggered it: a metric in
+// warm-up is exported with its initial value to all of them, and the warm-up of the metrics only advances with the
+// actual collections. Each scrape is still counted, see Scrapes.
+//
+// The returned metric families are shared between the callers and must not be modified.
+type CoalescingGatherer struct {
+	gatherer  prometheus.Gatherer
+	coalescer coalescer[[]*dto.MetricFamily]
+	scrapes   uint64
+	gathers   uint64
+}
+
+// NewCoalescingGatherer creates a new CoalescingGatherer gathering the given Gatherer.
+func NewCoalescingGatherer(gatherer prometheus.Gatherer, opts CoalescingOpts) *CoalescingGatherer {
+	return &CoalescingGatherer{
+		gatherer:  gatherer,
+		coalescer: coalescer[[]*dto.MetricFamily]{window: opts.FreshnessWindow, clock: opts.Clock},
+	}
+}
+
+// Gather implements [prometheus.Gatherer].
+func (g *CoalescingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	atomic.AddUint64(&g.scrapes, 1)
+	mfs, _, err := g.coalescer.do(func() ([]*dto.MetricFamily, error) {
+		atomic.AddUint64(&g.gathers, 1)
+		return g.gatherer.Gather()
+	})
+	return mfs, err
+}
+
+// Scrapes returns the number of calls to Gather.
+func (g *CoalescingGatherer) Scrapes() uint64 {
+	return atomic.LoadUint64(&g.scrapes)
+}
+
+// Gathers returns the number of gatherings of the underlying Gatherer, i.e. the number of collections.
+func (g *CoalescingGatherer) Gathers() uint64 {
+	return atomic.LoadUint64(&g.gathers)
+}
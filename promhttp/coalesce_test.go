@@ -0,0 +1,157 @@
+package promhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingGatherer is a Gatherer whose gatherings wait for the release channel.
+type blockingGatherer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *blockingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.started <- struct{}{}
+	<-g.release
+	return []*dto.MetricFamily{{}}, nil
+}
+
+func TestCoalescingGatherer_ConcurrentGathers(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	gatherer := &blockingGatherer{started: make(chan struct{}, 10), release: make(chan struct{})}
+	coalescing := NewCoalescingGatherer(gatherer, CoalescingOpts{Clock: clock})
+	joined := make(chan struct{}, 10)
+	coalescing.coalescer.joined = func() { joined <- struct{}{} }
+
+	results := make([][]*dto.MetricFamily, 3)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = coalescing.Gather()
+	}()
+	<-gatherer.started
+	for i := 1; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = coalescing.Gather()
+		}(i)
+	}
+	<-joined
+	<-joined
+	close(gatherer.release)
+	wg.Wait()
+
+	assert.Equal(t, uint64(3), coalescing.Scrapes())
+	assert.Equal(t, uint64(1), coalescing.Gathers())
+	assert.Same(t, results[0][0], results[1][0])
+	assert.Same(t, results[0][0], results[2][0])
+
+	// without freshness window, a later scrape triggers a new gathering even if the time did not change
+	_, _ = coalescing.Gather()
+	assert.Equal(t, uint64(2), coalescing.Gathers())
+}
+
+func TestCoalescingGatherer_FreshnessWindow(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	registry := prometheus.NewRegistry()
+	counter := metrics.NewCounterVec(metrics.CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Clock:       clock,
+	}, []string{"label"})
+	registry.MustRegister(counter)
+	coalescing := NewCoalescingGatherer(registry, CoalescingOpts{FreshnessWindow: 5 * time.Second, Clock: clock})
+
+	counter.WithLabelValues("toto").Add(3)
+	value := func() float64 {
+		mfs, err := coalescing.Gather()
+		assert.NoError(t, err)
+		return mfs[0].Metric[0].GetCounter().GetValue()
+	}
+
+	// both scrapers see the warm-up of the metric
+	assert.Equal(t, 0.0, value())
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, 0.0, value())
+	assert.Equal(t, uint64(1), coalescing.Gathers())
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 3.0, value())
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, 3.0, value())
+	assert.Equal(t, uint64(4), coalescing.Scrapes())
+	assert.Equal(t, uint64(2), coalescing.Gathers())
+}
+
+func TestCachingRegistry_CoalescesScrapes(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	registry := NewCachingRegistry(CachingRegistryOpts{CoalescingOpts{FreshnessWindow: 5 * time.Second, Clock: clock}})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge", Help: "Help message"})
+	registry.MustRegister(gauge)
+
+	gauge.Set(1)
+	assert.Contains(t, scrape(t, registry, ""), "gauge 1\n")
+	gauge.Set(2)
+	assert.Contains(t, scrape(t, registry, ""), "gauge 1\n")
+	clock.Advance(6 * time.Second)
+	assert.Contains(t, scrape(t, registry, ""), "gauge 2\n")
+	assert.Equal(t, uint64(3), registry.Scrapes())
+	assert.Equal(t, uint64(2), registry.Collections())
+}
+
+// panickingMetric is a metric whose encoding panics while panics is positive.
+type panickingMetric struct {
+	prometheus.Metric
+	panics *int32
+}
+
+func (m panickingMetric) Write(out *dto.Metric) error {
+	if atomic.AddInt32(m.panics, -1) >= 0 {
+		panic("broken metric")
+	}
+	return m.Metric.Write(out)
+}
+
+// panickingCollector is a collector of a single panickingMetric.
+type panickingCollector struct {
+	gauge  prometheus.Gauge
+	panics int32
+}
+
+func (c *panickingCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.gauge.Describe(ch)
+}
+
+func (c *panickingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- panickingMetric{Metric: c.gauge, panics: &c.panics}
+}
+
+func TestCachingRegistry_CollectionPanic(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	registry := NewCachingRegistry(CachingRegistryOpts{CoalescingOpts{FreshnessWindow: 5 * time.Second, Clock: clock}})
+	collector := &panickingCollector{
+		gauge:  prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge", Help: "Help message"}),
+		panics: 1,
+	}
+	registry.MustRegister(collector)
+
+	// the panic is reported as an error, and the failed collection is not shared with the next scrapes
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "broken metric")
+	assert.Contains(t, scrape(t, registry, ""), "gauge 0\n")
+	assert.Equal(t, uint64(2), registry.Collections())
+}
@@ -0,0 +1,246 @@
+// Package promhttp provides HTTP handlers and gatherers to expose the metrics of this library efficiently.
+//
+// It complements the [promhttp] package of the Prometheus golang client.
+//
+// [promhttp]: https://pkg.go.dev/github.com/prometheus/client_golang/prometheus/promhttp
+package promhttp
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// CachingRegistry is a registry of collectors whose HTTP handler caches the encoded exposition of each series,
+// in both the text and the protobuf formats. A scrape only encodes the series that are new, whose value changed, or
+// whose warm-up state changed since the previous scrape. The series that are not collected anymore (expired or
+// deleted) are dropped from the cache.
+//
+// The cache trades memory (the last value and the encodings of each series) for the CPU of the scrapes: it pays off
+// for large exporters whose series mostly keep their value between two scrapes.
+//
+// The concurrent scrapes share the same collection, as well as the scrapes within the freshness window of the
+// coalescing options (see CoalescingGatherer).
+//
+// CachingRegistry implements [prometheus.Registerer], [prometheus.Gatherer] and [http.Handler].
+// Its Gather method is not cached, and works exactly like the one of [prometheus.Registry].
+type CachingRegistry struct {
+	// validates the registered collectors and implements Gather
+	registry *prometheus.Registry
+
+	collectorsMutex sync.RWMutex
+	collectors      []prometheus.Collector
+
+	// serializes the updates of the cache
+	cacheMutex  sync.Mutex
+	cache       *encodingCache
+	coalescer   coalescer[*snapshot]
+	scrapes     uint64
+	collections uint64
+}
+
+// CachingRegistryOpts are the options of a CachingRegistry.
+type CachingRegistryOpts struct {
+	// CoalescingOpts are the options of the coalescing of the scrapes.
+	CoalescingOpts
+}
+
+// NewCachingRegistry creates a new CachingRegistry.
+func NewCachingRegistry(opts CachingRegistryOpts) *CachingRegistry {
+	return &CachingRegistry{
+		registry:  prometheus.NewRegistry(),
+		cache:     newEncodingCache(),
+		coalescer: coalescer[*snapshot]{window: opts.FreshnessWindow, clock: opts.Clock},
+	}
+}
+
+// Register implements [prometheus.Registerer].
+func (r *CachingRegistry) Register(c prometheus.Collector) error {
+	r.collectorsMutex.Lock()
+	defer r.collectorsMutex.Unlock()
+	if err := r.registry.Register(c); err != nil {
+		return err
+	}
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// MustRegister implements [prometheus.Registerer].
+func (r *CachingRegistry) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements [prometheus.Registerer].
+func (r *CachingRegistry) Unregister(c prometheus.Collector) bool {
+	r.collectorsMutex.Lock()
+	defer r.collectorsMutex.Unlock()
+	if !r.registry.Unregister(c) {
+		return false
+	}
+	for i, collector := range r.collectors {
+		if collector == c {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Gather implements [prometheus.Gatherer].
+func (r *CachingRegistry) Gather() ([]*dto.MetricFamily, error) {
+	return r.registry.Gather()
+}
+
+// collect collects the metrics of the registered collectors, concurrently like the prometheus registry does.
+// The order of the returned metrics is not defined.
+func (r *CachingRegistry) collect() []prometheus.Metric {
+	r.collectorsMutex.RLock()
+	collectors := append([]prometheus.Collector(nil), r.collectors...)
+	r.collectorsMutex.RUnlock()
+
+	ch := make(chan prometheus.Metric, 1024)
+	var wg sync.WaitGroup
+	wg.Add(len(collectors))
+	for _, collector := range collectors {
+		go func(collector prometheus.Collector) {
+			defer wg.Done()
+			collector.Collect(ch)
+		}(collector)
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// ServeHTTP implements [http.Handler]. It serves the metrics of the registered collectors in the format
+// negotiated with the client, compressed with gzip when accepted. The text and protobuf delimited formats
+// are served from the cache.
+//
+// When some metrics cannot be collected, or are inconsistent like the prometheus registry would report them (a series
+// collected twice, or a family collected with different types or help), it responds with an internal server error.
+func (r *CachingRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddUint64(&r.scrapes, 1)
+	snap, _, err := r.coalescer.do(r.update)
+	if err != nil {
+		http.Error(w, "An error has occurred while serving metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	format := expfmt.Negotiate(req.Header)
+	header := w.Header()
+	header.Set("Content-Type", string(format))
+	var out io.Writer = w
+	if acceptsGzip(req) {
+		header.Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	if err := snap.encode(out, format); err != nil {
+		// the response is already partially written, nothing can be reported to the client
+		return
+	}
+}
+
+// update collects the metrics and updates the cache. The returned snapshot is not modified by the next updates.
+func (r *CachingRegistry) update() (*snapshot, error) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	atomic.AddUint64(&r.collections, 1)
+	snap, errs := r.cache.update(r.collect())
+	if len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Error()
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+	return snap, nil
+}
+
+// Scrapes returns the number of scrapes served by the registry.
+func (r *CachingRegistry) Scrapes() uint64 {
+	return atomic.LoadUint64(&r.scrapes)
+}
+
+// Collections returns the number of collections of the registered collectors by the scrapes.
+func (r *CachingRegistry) Collections() uint64 {
+	return atomic.LoadUint64(&r.collections)
+}
+
+func acceptsGzip(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.Split(part, ";")[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the snapshot in the given format, using the cached encodings for the text and protobuf
+// delimited formats.
+func (s *snapshot) encode(w io.Writer, format expfmt.Format) error {
+	switch format {
+	case expfmt.FmtText:
+		for i, fam := range s.families {
+			if _, err := w.Write(fam.textHeader); err != nil {
+				return err
+			}
+			for _, entry := range s.series[i] {
+				if _, err := w.Write(entry.text); err != nil {
+					return err
+				}
+			}
+		}
+	case expfmt.FmtProtoDelim:
+		for i, fam := range s.families {
+			size := len(fam.protoHeader)
+			for _, entry := range s.series[i] {
+				size += len(entry.proto)
+			}
+			if _, err := w.Write(proto.EncodeVarint(uint64(size))); err != nil {
+				return err
+			}
+			if _, err := w.Write(fam.protoHeader); err != nil {
+				return err
+			}
+			for _, entry := range s.series[i] {
+				if _, err := w.Write(entry.proto); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		enc := expfmt.NewEncoder(w, format)
+		for i, fam := range s.families {
+			mf := &dto.MetricFamily{Name: &fam.name, Help: &fam.help, Type: &fam.typ}
+			for _, entry := range s.series[i] {
+				mf.Metric = append(mf.Metric, entry.metric)
+			}
+			if err := enc.Encode(mf); err != nil {
+				return fmt.Errorf("error encoding metric family %s: %w", fam.name, err)
+			}
+		}
+	}
+	return nil
+}
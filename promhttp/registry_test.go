@@ -0,0 +1,261 @@
+package promhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const acceptProto = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited"
+
+func scrape(t *testing.T, handler http.Handler, accept string) string {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestCachingRegistry_SameExpositionAsPrometheus(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	registry := NewCachingRegistry(CachingRegistryOpts{})
+	counter := metrics.NewCounterVec(metrics.CounterOpts{
+		CounterOpts: prometheus.CounterOpts{
+			Name:        "count",
+			Help:        "Help message\nwith \\ special characters",
+			ConstLabels: prometheus.Labels{"app": "test"},
+		},
+		WarmUpDuration:  10 * time.Second,
+		ExpirationDelay: time.Minute,
+		Clock:           clock,
+	}, []string{"label", "other"})
+	histogram := metrics.NewHistogramVec(metrics.HistogramOpts{
+		HistogramOpts: prometheus.HistogramOpts{
+			Name:    "hist",
+			Help:    "Help message",
+			Buckets: []float64{1, 10},
+		},
+		Clock: clock,
+	}, []string{"label"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge"})
+	registry.MustRegister(counter, histogram, gauge)
+	reference := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	check := func() {
+		// the reference handler collects the metrics as well, so the state of the metrics is checked with
+		// the caching registry first, and the reference must be stable
+		for _, accept := range []string{"", acceptProto} {
+			cached := scrape(t, registry, accept)
+			assert.Equal(t, scrape(t, reference, accept), cached)
+		}
+	}
+
+	counter.WithLabelValues("toto", "a").Inc()
+	counter.WithLabelValues("titi", "b").Add(3)
+	counter.WithLabelValues("t", "z").Add(3)
+	histogram.WithLabelValues("toto").Observe(2)
+	gauge.Set(4)
+	check()
+
+	clock.Advance(11 * time.Second)
+	counter.WithLabelValues("toto", "a").Inc()
+	histogram.WithLabelValues("toto").Observe(0.5)
+	gauge.Set(-1)
+	check()
+	check()
+
+	clock.Advance(2 * time.Minute)
+	counter.WithLabelValues("toto", "a").Inc()
+	check()
+}
+
+func TestCachingRegistry_EncodesOnlyChangedSeries(t *testing.T) {
+	registry := NewCachingRegistry(CachingRegistryOpts{})
+	counter := metrics.NewCounterVec(metrics.CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+	}, []string{"label"})
+	registry.MustRegister(counter)
+
+	counter.WithLabelValues("toto").Inc()
+	counter.WithLabelValues("titi").Inc()
+	// first scrape in warm-up, second with the actual values
+	scrape(t, registry, "")
+	scrape(t, registry, "")
+	entries := make(map[prometheus.Metric]*seriesEntry)
+	for metric, entry := range registry.cache.series {
+		entries[metric] = entry
+	}
+	assert.Len(t, entries, 2)
+
+	counter.WithLabelValues("toto").Inc()
+	body := scrape(t, registry, "")
+	assert.Contains(t, body, `count{_tag_=`)
+	assert.Len(t, registry.cache.series, 2)
+	for metric, entry := range registry.cache.series {
+		if metric == counter.WithLabelValues("toto") {
+			assert.NotSame(t, entries[metric], entry)
+		} else {
+			assert.Same(t, entries[metric], entry)
+		}
+	}
+
+	// deleted series are dropped from the cache
+	counter.DeleteLabelValues("toto")
+	scrape(t, registry, "")
+	assert.Len(t, registry.cache.series, 1)
+	registry.Unregister(counter)
+	assert.Equal(t, "", scrape(t, registry, ""))
+	assert.Len(t, registry.cache.series, 0)
+	assert.Len(t, registry.cache.families, 0)
+}
+
+func TestCachingRegistry_Gzip(t *testing.T) {
+	registry := NewCachingRegistry(CachingRegistryOpts{})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge", Help: "Help message"})
+	registry.MustRegister(gauge)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, req)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+}
+
+// uncheckedCollector is an unchecked collector (describing no metric) of constant metrics.
+type uncheckedCollector []prometheus.Metric
+
+func (c uncheckedCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c uncheckedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range c {
+		ch <- metric
+	}
+}
+
+func TestCachingRegistry_InconsistentSeries(t *testing.T) {
+	desc := prometheus.NewDesc("series", "Help message", []string{"label"}, nil)
+	serve := func(collectors ...prometheus.Collector) *httptest.ResponseRecorder {
+		registry := NewCachingRegistry(CachingRegistryOpts{})
+		registry.MustRegister(collectors...)
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec
+	}
+
+	// a series collected twice fails the scrape, like with the prometheus registry
+	rec := serve(
+		uncheckedCollector{prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "a")},
+		uncheckedCollector{prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 2, "a"),
+			prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 3, "b")},
+	)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "was collected before with the same name and label values")
+
+	// so does a family collected with different types
+	other := prometheus.NewDesc("series", "Help message", []string{"other"}, nil)
+	rec = serve(
+		uncheckedCollector{prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "a")},
+		uncheckedCollector{prometheus.MustNewConstMetric(other, prometheus.CounterValue, 1, "a")},
+	)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "should have help")
+
+	// the same label values with different label names are distinct series
+	rec = serve(
+		uncheckedCollector{prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "a")},
+		uncheckedCollector{prometheus.MustNewConstMetric(other, prometheus.GaugeValue, 1, "a")},
+	)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// barrierCollector collects a gauge once all the barrierCollectors sharing its WaitGroup are collecting.
+type barrierCollector struct {
+	prometheus.Gauge
+	barrier *sync.WaitGroup
+}
+
+func (c barrierCollector) Collect(ch chan<- prometheus.Metric) {
+	c.barrier.Done()
+	c.barrier.Wait()
+	c.Gauge.Collect(ch)
+}
+
+func TestCachingRegistry_CollectsConcurrently(t *testing.T) {
+	registry := NewCachingRegistry(CachingRegistryOpts{})
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	registry.MustRegister(
+		barrierCollector{prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge1", Help: "Help message"}), &barrier},
+		barrierCollector{prometheus.NewGauge(prometheus.GaugeOpts{Name: "gauge2", Help: "Help message"}), &barrier},
+	)
+
+	// the collectors would block each other if they were collected one after the other
+	done := make(chan string)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, req)
+		done <- rec.Body.String()
+	}()
+	select {
+	case body := <-done:
+		assert.Contains(t, body, "gauge1 0\n")
+		assert.Contains(t, body, "gauge2 0\n")
+	case <-time.After(10 * time.Second):
+		t.Fatal("the collectors were not collected concurrently")
+	}
+}
+
+func benchmarkScrape(b *testing.B, newHandler func(prometheus.Collector) http.Handler) {
+	counter := metrics.NewCounterVec(metrics.CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+	}, []string{"label"})
+	for i := 0; i < 100000; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+	}
+	handler := newHandler(counter)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// a few percent of the series change between two scrapes
+		for j := 0; j < 1000; j++ {
+			counter.WithLabelValues(strconv.Itoa((i*1000 + j) % 100000)).Inc()
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkCachingRegistry_Scrape(b *testing.B) {
+	benchmarkScrape(b, func(c prometheus.Collector) http.Handler {
+		registry := NewCachingRegistry(CachingRegistryOpts{})
+		registry.MustRegister(c)
+		return registry
+	})
+}
+
+// BenchmarkPrometheusHandler_Scrape is the reference for BenchmarkCachingRegistry_Scrape.
+func BenchmarkPrometheusHandler_Scrape(b *testing.B) {
+	benchmarkScrape(b, func(c prometheus.Collector) http.Handler {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	})
+}
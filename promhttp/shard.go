@@ -0,0 +1,134 @@
+package promhttp
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const defaultShardParam = "shard"
+
+// ShardingOpts are the options of the scrape sharding.
+type ShardingOpts struct {
+	// Shards is the number of shards the series are split across.
+	Shards int
+	// QueryParam is the name of the query parameter holding the index of the shard to serve,
+	// from 0 to Shards-1 ("shard" by default).
+	QueryParam string
+	// HandlerOpts are the options of the handlers serving the shards.
+	HandlerOpts promhttp.HandlerOpts
+	// CoalescingOpts are the options of the CoalescingGatherer sharing a single gathering between the scrapes of
+	// the shards, unless the Gatherer already is a CoalescingGatherer. Its FreshnessWindow should cover the spread
+	// of the scrapes of the shards, otherwise only the concurrent ones share the same gathering.
+	CoalescingOpts CoalescingOpts
+}
+
+// ShardedGatherer is a [prometheus.Gatherer] returning the series of one shard of another Gatherer. The series are
+// assigned to the shards by a stable hash of their metric name and labels. The label LabelLifeCycleTag of the vectors
+// of this library is excluded from the hash, so that a series stays in the same shard across its life cycles.
+type ShardedGatherer struct {
+	gatherer prometheus.Gatherer
+	shards   int
+	shard    int
+}
+
+// NewShardedGatherer creates a new ShardedGatherer returning the series of the given shard, out of the given number
+// of shards. It panics if the shard is not in [0, shards).
+func NewShardedGatherer(gatherer prometheus.Gatherer, shards int, shard int) *ShardedGatherer {
+	if shard < 0 || shard >= shards {
+		panic(fmt.Errorf("shard %d out of range [0, %d)", shard, shards))
+	}
+	return &ShardedGatherer{gatherer: gatherer, shards: shards, shard: shard}
+}
+
+// Gather implements [prometheus.Gatherer]. It gathers all the series of the underlying Gatherer before keeping the
+// ones of its shard: the ShardedGatherers of the same Gatherer should share it through a CoalescingGatherer.
+func (g *ShardedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.gatherer.Gather()
+	// the metric families may be shared (see CoalescingGatherer), they are copied
+	sharded := make([]*dto.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		var series []*dto.Metric
+		for _, m := range mf.Metric {
+			if int(seriesHash(mf.GetName(), m)%uint64(g.shards)) == g.shard {
+				series = append(series, m)
+			}
+		}
+		if len(series) > 0 {
+			sharded = append(sharded, &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Metric: series})
+		}
+	}
+	return sharded, err
+}
+
+// seriesHash returns the fnv64a hash of the metric name and the labels of a series, excluding the life cycle tag.
+func seriesHash(name string, m *dto.Metric) uint64 {
+	labels := make([]*dto.LabelPair, 0, len(m.Label))
+	for _, pair := range m.Label {
+		if pair.GetName() != metrics.LabelLifeCycleTag {
+			labels = append(labels, pair)
+		}
+	}
+	// the labels written by the prometheus metrics are sorted, but not necessarily the ones of other collectors
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+
+	hash := hashString(offset64, name)
+	for _, pair := range labels {
+		hash = hashString(hash, "\xff")
+		hash = hashString(hash, pair.GetName())
+		hash = hashString(hash, "\xff")
+		hash = hashString(hash, pair.GetValue())
+	}
+	return hash
+}
+
+const (
+	offset64 uint64 = 14695981039346656037
+	prime64  uint64 = 1099511628211
+)
+
+func hashString(hash uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= prime64
+	}
+	return hash
+}
+
+// ShardedHandler returns an [http.Handler] serving the series of the given Gatherer split across several shards, the
+// shard to serve being given by a query parameter (e.g. /metrics?shard=2). This allows several scrape jobs to pull
+// large vectors in parallel. Alternatively, each shard can be served at its own path with the handlers of
+// NewShardedGatherer.
+//
+// The Gatherer is wrapped in a CoalescingGatherer with the CoalescingOpts of the options, unless it already is one,
+// so that the scrapes of the shards share a single gathering of all the series.
+func ShardedHandler(gatherer prometheus.Gatherer, opts ShardingOpts) http.Handler {
+	if opts.Shards <= 0 {
+		panic(fmt.Errorf("invalid number of shards %d", opts.Shards))
+	}
+	if _, ok := gatherer.(*CoalescingGatherer); !ok {
+		gatherer = NewCoalescingGatherer(gatherer, opts.CoalescingOpts)
+	}
+	param := opts.QueryParam
+	if param == "" {
+		param = defaultShardParam
+	}
+	handlers := make([]http.Handler, opts.Shards)
+	for i := range handlers {
+		handlers[i] = promhttp.HandlerFor(NewShardedGatherer(gatherer, opts.Shards, i), opts.HandlerOpts)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		shard, err := strconv.Atoi(req.URL.Query().Get(param))
+		if err != nil || shard < 0 || shard >= len(handlers) {
+			http.Error(w, fmt.Sprintf("invalid %s parameter, expected a shard in [0, %d)", param, len(handlers)), http.StatusBadRequest)
+			return
+		}
+		handlers[shard].ServeHTTP(w, req)
+	})
+}
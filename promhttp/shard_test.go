@@ -0,0 +1,135 @@
+package promhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/goto-opensource/smart-prometheus-client/metrics"
+	"github.com/goto-opensource/smart-prometheus-client/metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, pair := range m.Label {
+		if pair.GetName() == name {
+			return pair.GetValue()
+		}
+	}
+	return ""
+}
+
+// shardOf returns the shard of each series of the counter, indexed by label value.
+func shardOf(t *testing.T, gatherer prometheus.Gatherer, shards int) map[string]int {
+	result := make(map[string]int)
+	for shard := 0; shard < shards; shard++ {
+		mfs, err := NewShardedGatherer(gatherer, shards, shard).Gather()
+		require.NoError(t, err)
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				value := labelValue(m, "label")
+				_, present := result[value]
+				assert.False(t, present, "series %s served by several shards", value)
+				result[value] = shard
+			}
+		}
+	}
+	return result
+}
+
+func TestShardedGatherer_SplitsSeries(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	registry := prometheus.NewRegistry()
+	counter := metrics.NewCounterVec(metrics.CounterOpts{
+		CounterOpts: prometheus.CounterOpts{Name: "count", Help: "Help message"},
+		Clock:       clock,
+	}, []string{"label"})
+	registry.MustRegister(counter)
+	for i := 0; i < 100; i++ {
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+	}
+
+	shards := shardOf(t, registry, 4)
+	assert.Len(t, shards, 100)
+	counts := make([]int, 4)
+	for _, shard := range shards {
+		counts[shard]++
+	}
+	for _, count := range counts {
+		assert.Greater(t, count, 10)
+	}
+
+	// a series keeps its shard when it starts a new life cycle
+	clock.Advance(time.Hour)
+	for i := 0; i < 100; i++ {
+		counter.DeleteLabelValues(strconv.Itoa(i))
+		counter.WithLabelValues(strconv.Itoa(i)).Inc()
+	}
+	assert.Equal(t, shards, shardOf(t, registry, 4))
+}
+
+func TestShardedHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "gauge", Help: "Help message"}, []string{"label"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("toto").Set(1)
+	gauge.WithLabelValues("titi").Set(2)
+	handler := ShardedHandler(registry, ShardingOpts{Shards: 2})
+
+	body := ""
+	for shard := 0; shard < 2; shard++ {
+		req := httptest.NewRequest(http.MethodGet, "/metrics?shard="+strconv.Itoa(shard), nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		body += rec.Body.String()
+	}
+	assert.Contains(t, body, `gauge{label="toto"} 1`)
+	assert.Contains(t, body, `gauge{label="titi"} 2`)
+
+	for _, query := range []string{"", "?shard=2", "?shard=x"} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics"+query, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+}
+
+// countingGatherer is a Gatherer counting its gatherings.
+type countingGatherer struct {
+	prometheus.Gatherer
+	gathers int
+}
+
+func (g *countingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.gathers++
+	return g.Gatherer.Gather()
+}
+
+func TestShardedHandler_SharesGathering(t *testing.T) {
+	clock := metricstest.NewFakeClock(time.Unix(1219204980, 0))
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "gauge", Help: "Help message"}, []string{"label"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("toto").Set(1)
+	gatherer := &countingGatherer{Gatherer: registry}
+	handler := ShardedHandler(gatherer, ShardingOpts{
+		Shards:         4,
+		CoalescingOpts: CoalescingOpts{FreshnessWindow: 5 * time.Second, Clock: clock},
+	})
+
+	// the scrapes of the shards within the freshness window share a single gathering
+	for shard := 0; shard < 4; shard++ {
+		req := httptest.NewRequest(http.MethodGet, "/metrics?shard="+strconv.Itoa(shard), nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		clock.Advance(time.Second)
+	}
+	assert.Equal(t, 1, gatherer.gathers)
+}